@@ -0,0 +1,226 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"example.com/containeredu/internal/cgroups"
+	"example.com/containeredu/internal/pty"
+	"example.com/containeredu/internal/state"
+)
+
+// namespaces joined by exec, in setns order; mnt comes last because it
+// changes how the remaining /proc paths would resolve.
+var execNamespaces = []struct {
+	name string
+	flag int
+}{
+	{"uts", syscall.CLONE_NEWUTS},
+	{"net", syscall.CLONE_NEWNET},
+	{"pid", syscall.CLONE_NEWPID},
+	{"ipc", syscall.CLONE_NEWIPC},
+	{"mnt", syscall.CLONE_NEWNS},
+}
+
+// execInContainer runs command inside a running container and returns its
+// exit code.
+func execInContainer(ref string, command []string, interactive, tty bool) (int, error) {
+	st, err := state.Find(ref)
+	if err != nil {
+		return -1, err
+	}
+	if !st.IsActive() || !st.Alive() {
+		return -1, fmt.Errorf("container %s is not running", st.ID)
+	}
+	// the container may lack /dev/null or a usable /dev/pts, so stdio is
+	// always set up from the host side before entering it
+	stdin, stdout, stderr := os.Stdin, os.Stdout, os.Stderr
+	if !interactive {
+		devNull, err := os.Open(os.DevNull)
+		if err != nil {
+			return -1, err
+		}
+		defer devNull.Close()
+		stdin = devNull
+	}
+	detach := func() {}
+	if tty {
+		master, slave, err := pty.Open()
+		if err != nil {
+			return -1, fmt.Errorf("allocate pty: %w", err)
+		}
+		var in *os.File
+		if interactive {
+			in = os.Stdin
+		}
+		detach = attachTTY(master, in, os.Stdout)
+		stdin, stdout, stderr = slave, slave, slave
+	}
+	// older containers have no recorded options and run as they did
+	opts, _ := loadRunOptions(st.ID)
+	// opened before the chroot below hides the host's cgroupfs; cgroup
+	// setup is best-effort at run, so a container may have none
+	group, err := cgroups.Open(st.ID)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		detach()
+		return -1, err
+	}
+	if group != nil {
+		defer group.Close()
+	}
+	type started struct {
+		cmd *exec.Cmd
+		err error
+	}
+	ch := make(chan started, 1)
+	go func() {
+		// setns and chroot only affect this thread, which is thrown away
+		// when the goroutine exits because it is never unlocked
+		runtime.LockOSThread()
+		cmd, err := startInNamespaces(st, opts, group, command, stdin, stdout, stderr, tty)
+		ch <- started{cmd, err}
+	}()
+	res := <-ch
+	if tty {
+		// only the child may hold the slave, or the relay never sees EOF
+		stdin.Close()
+	}
+	if res.err != nil {
+		detach()
+		return -1, res.err
+	}
+	err = res.cmd.Wait()
+	detach()
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		return -1, err
+	}
+	return exitCode(res.cmd.ProcessState), nil
+}
+
+// startInNamespaces must run on a locked OS thread. The child is forked
+// from that thread and so inherits its namespaces and root. It gets the
+// environment, working directory and user the container was started with,
+// and starts in the cgroup group, if there is one, so it is never outside
+// the container's limits. With tty set, stdin must be a pty slave; it becomes the child's
+// controlling terminal.
+func startInNamespaces(st state.ContainerState, opts runOptions, group *os.File, command []string, stdin, stdout, stderr *os.File, tty bool) (*exec.Cmd, error) {
+	// Go threads share fs state, which makes setns into a mount namespace
+	// fail; give this thread its own copy first
+	if err := syscall.Unshare(syscall.CLONE_FS); err != nil {
+		return nil, fmt.Errorf("unshare fs: %w", err)
+	}
+	var fds []int
+	defer func() {
+		for _, fd := range fds {
+			syscall.Close(fd)
+		}
+	}()
+	for _, ns := range execNamespaces {
+		fd, err := syscall.Open(fmt.Sprintf("/proc/%d/ns/%s", st.Pid, ns.name), syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+		if err != nil {
+			return nil, fmt.Errorf("open %s namespace: %w", ns.name, err)
+		}
+		fds = append(fds, fd)
+	}
+	// the container's root as its init sees it, i.e. the mounted MountDir
+	rootFD, err := syscall.Open(fmt.Sprintf("/proc/%d/root", st.Pid), syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("open container root: %w", err)
+	}
+	fds = append(fds, rootFD)
+	for i, ns := range execNamespaces {
+		if err := setns(fds[i], ns.flag); err != nil {
+			return nil, fmt.Errorf("setns %s: %w", ns.name, err)
+		}
+	}
+	if err := syscall.Fchdir(rootFD); err != nil {
+		return nil, fmt.Errorf("fchdir: %w", err)
+	}
+	if err := syscall.Chroot("."); err != nil {
+		return nil, fmt.Errorf("chroot: %w", err)
+	}
+	if err := syscall.Chdir("/"); err != nil {
+		return nil, err
+	}
+	u, err := resolveUser("/", opts.User)
+	if err != nil {
+		return nil, err
+	}
+	env := withDefaults(opts.Env, "PATH="+containerPath, "HOSTNAME="+st.Hostname, "HOME="+u.Home)
+	if tty {
+		if term := os.Getenv("TERM"); term != "" {
+			env = withDefaults(env, "TERM="+term)
+		}
+	}
+	path, err := lookPathIn(command[0], envValue(env, "PATH"))
+	if err != nil {
+		return nil, err
+	}
+	cmd := &exec.Cmd{Path: path, Args: command, Env: env, Dir: opts.WorkingDir}
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+	if tty {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+	}
+	if group != nil {
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = int(group.Fd())
+	}
+	if opts.User != "" {
+		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: u.Uid, Gid: u.Gid, Groups: u.Groups}
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// lookPathIn resolves name against pathList relative to the current root;
+// exec.LookPath would use the host's PATH instead.
+func lookPathIn(name, pathList string) (string, error) {
+	if strings.Contains(name, "/") {
+		return name, nil
+	}
+	for _, dir := range filepath.SplitList(pathList) {
+		p := filepath.Join(dir, name)
+		if fi, err := os.Stat(p); err == nil && !fi.IsDir() && fi.Mode()&0o111 != 0 {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("%s: executable file not found in container PATH", name)
+}
+
+func setns(fd, nstype int) error {
+	var nr uintptr
+	switch runtime.GOARCH {
+	case "amd64":
+		nr = 308
+	case "386":
+		nr = 346
+	case "arm":
+		nr = 375
+	case "arm64", "riscv64", "loong64":
+		nr = 268
+	case "ppc64", "ppc64le":
+		nr = 350
+	case "s390x":
+		nr = 339
+	default:
+		return fmt.Errorf("setns unsupported on %s", runtime.GOARCH)
+	}
+	if _, _, e := syscall.RawSyscall(nr, uintptr(fd), uintptr(nstype), 0); e != 0 {
+		return e
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+func execInContainer(ref string, command []string, interactive, tty bool) (int, error) {
+	return -1, fmt.Errorf("exec is only supported on linux")
+}
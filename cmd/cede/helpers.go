@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"os"
@@ -43,10 +44,11 @@ func buildImage(dockerfile, tag string) error {
 	if lines[0].Arg != "scratch" {
 		return fmt.Errorf("only FROM scratch supported")
 	}
-	root := filepath.Join(paths.ImagesRoot(), tag, "layers", "00")
-	if err := os.MkdirAll(root, 0o755); err != nil {
+	root, err := images.NewLayerDir()
+	if err != nil {
 		return err
 	}
+	defer os.RemoveAll(root)
 	for _, l := range lines {
 		if l.Keyword == "ADD" {
 			parts := splitTwo(l.Arg)
@@ -60,37 +62,83 @@ func buildImage(dockerfile, tag string) error {
 			}
 		}
 	}
-	meta := struct {
-		Name   string   `json:"name"`
-		Layers []string `json:"layers"`
-	}{
-		Name:   tag,
-		Layers: []string{"00"},
+	digest, err := images.CommitLayer(root)
+	if err != nil {
+		return err
 	}
-	imgMeta := filepath.Join(paths.ImagesRoot(), tag, "metadata.json")
-	if err := os.MkdirAll(filepath.Dir(imgMeta), 0o755); err != nil {
+	if err := images.SaveManifest(images.Manifest{Name: tag, Layers: []string{digest}, LayerOrder: images.OrderTopFirst}); err != nil {
 		return err
 	}
-	b, _ := json.MarshalIndent(meta, "", "  ")
-	return os.WriteFile(imgMeta, b, 0o644)
+	pruneLegacyLayers(tag)
+	return nil
 }
 
 func importImageTar(tarPath, name string) error {
-	return images.ImportDockerSaveTar(tarPath, name)
+	imported, err := images.Import(tarPath, name)
+	for _, img := range imported {
+		fmt.Printf("Loaded image %s (id %s, %d/%d layers new)\n", strings.Join(img.Names, ", "), img.ShortID(), img.NewLayers, img.Layers)
+		for _, n := range img.Names {
+			pruneLegacyLayers(n)
+		}
+	}
+	return err
 }
 
-func listContainers() error {
+// verifyImages checks each image against the digests recorded on import,
+// stopping at the first that does not match.
+func verifyImages(names []string) error {
+	for _, n := range names {
+		if err := images.Verify(n); err != nil {
+			return err
+		}
+		fmt.Printf("%s: ok\n", n)
+	}
+	return nil
+}
+
+// pruneLegacyLayers drops the per-image layer directories image had before
+// the layer store once no container is left that may stack on them.
+func pruneLegacyLayers(image string) {
+	items, err := state.List()
+	if err != nil {
+		return
+	}
+	var inUse []string
+	for _, it := range items {
+		inUse = append(inUse, it.Image)
+	}
+	if err := images.PruneLegacyLayers(image, inUse); err != nil {
+		fmt.Fprintf(os.Stderr, "image %s: remove old layers: %v\n", image, err)
+	}
+}
+
+func listContainers(showSize bool) error {
 	items, err := state.List()
 	if err != nil {
 		return err
 	}
-	fmt.Printf("ID\tIMAGE\tPID\tSTATUS\tIP\tCMD\n")
+	if showSize {
+		fmt.Printf("ID\tIMAGE\tPID\tSTATUS\tIP\tSIZE\tCMD\n")
+	} else {
+		fmt.Printf("ID\tIMAGE\tPID\tSTATUS\tIP\tCMD\n")
+	}
 	for _, it := range items {
-		fmt.Printf("%s\t%s\t%d\t%s\t%s\t%s %v\n", it.ID, it.Image, it.Pid, it.Status, it.IP, it.Command, it.Args)
+		if showSize {
+			fmt.Printf("%s\t%s\t%d\t%s\t%s\t%s\t%s %v\n", it.ID, it.Image, it.Pid, statusText(it), it.IP, containerSize(it), it.Command, it.Args)
+			continue
+		}
+		fmt.Printf("%s\t%s\t%d\t%s\t%s\t%s %v\n", it.ID, it.Image, it.Pid, statusText(it), it.IP, it.Command, it.Args)
 	}
 	return nil
 }
 
+func statusText(s state.ContainerState) string {
+	if s.Status == state.StatusExited {
+		return fmt.Sprintf("%s (%d)", s.Status, s.ExitCode)
+	}
+	return s.Status
+}
+
 func netList() error {
 	// print current assignments
 	fmt.Printf("ID\tIP\n")
@@ -126,6 +174,79 @@ func netpoolList() map[string]string {
 	return v.Assignments
 }
 
+// stringList is a flag.Value collecting every occurrence of a repeatable
+// flag such as --log-opt.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// parseKeyValues turns key=value pairs into a map.
+func parseKeyValues(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	out := map[string]string{}
+	for _, p := range pairs {
+		k, v, ok := strings.Cut(p, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", p)
+		}
+		out[k] = v
+	}
+	return out, nil
+}
+
+// parseInterspersed parses fs from args while allowing flags to follow the
+// positional arguments, as in `cede stop <id> --time 5`. It returns the
+// positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var pos []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return pos
+		}
+		if args[0] == "--" {
+			return append(pos, args[1:]...)
+		}
+		pos = append(pos, args[0])
+		args = args[1:]
+	}
+}
+
+// expandShortFlags splits combined single-letter boolean flags such as -it
+// into -i -t, stopping at the first positional argument.
+func expandShortFlags(args []string, letters string) []string {
+	out := make([]string, 0, len(args))
+	for i, a := range args {
+		if a == "--" || !strings.HasPrefix(a, "-") || strings.HasPrefix(a, "--") {
+			return append(out, args[i:]...)
+		}
+		name := a[1:]
+		combined := len(name) > 1
+		for _, c := range name {
+			if !strings.ContainsRune(letters, c) {
+				combined = false
+				break
+			}
+		}
+		if !combined {
+			out = append(out, a)
+			continue
+		}
+		for _, c := range name {
+			out = append(out, "-"+string(c))
+		}
+	}
+	return out
+}
+
 func splitLines(s string) []string {
 	lines := []string{}
 	start := 0
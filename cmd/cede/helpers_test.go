@@ -1,9 +1,13 @@
 package main
 
 import (
+	"flag"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"example.com/containeredu/internal/state"
 )
 
 func TestIOCopyAndCopyFile(t *testing.T) {
@@ -136,3 +140,72 @@ func TestCopyDirRecursive(t *testing.T) {
 		t.Fatalf("file2.txt not copied: %v", err)
 	}
 }
+
+func TestRunOptionsRoundTrip(t *testing.T) {
+	tmp := t.TempDir()
+	os.Setenv("HOME", tmp)
+	opts := runOptions{Image: "busybox", Command: "/bin/sh", Args: []string{"-c", "true"}, PidsMax: 8, Detach: true}
+	if err := saveRunOptions("abc", opts); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadRunOptions("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Image != "busybox" || len(got.Args) != 2 || got.PidsMax != 8 || !got.Detach {
+		t.Fatalf("unexpected options: %+v", got)
+	}
+	if _, err := loadRunOptions("missing"); err == nil {
+		t.Fatalf("expected error for missing options")
+	}
+}
+
+func TestStatusText(t *testing.T) {
+	if got := statusText(state.ContainerState{Status: state.StatusExited, ExitCode: 137}); got != "exited (137)" {
+		t.Fatalf("exited status: %q", got)
+	}
+	if got := statusText(state.ContainerState{Status: state.StatusRunning}); got != "running" {
+		t.Fatalf("running status: %q", got)
+	}
+}
+
+func TestParseInterspersed(t *testing.T) {
+	fs := flag.NewFlagSet("stop", flag.ContinueOnError)
+	timeout := fs.Int("time", 10, "")
+	pos := parseInterspersed(fs, []string{"abc", "--time", "3", "def"})
+	if *timeout != 3 {
+		t.Fatalf("flag after positional not parsed: %d", *timeout)
+	}
+	if len(pos) != 2 || pos[0] != "abc" || pos[1] != "def" {
+		t.Fatalf("unexpected positional args: %v", pos)
+	}
+	pos = parseInterspersed(fs, []string{"--", "-x"})
+	if len(pos) != 1 || pos[0] != "-x" {
+		t.Fatalf("args after -- should be kept: %v", pos)
+	}
+}
+
+func TestExpandShortFlags(t *testing.T) {
+	got := expandShortFlags([]string{"-it", "abc", "-it"}, "it")
+	want := []string{"-i", "-t", "abc", "-it"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("expandShortFlags = %v, want %v", got, want)
+	}
+	got = expandShortFlags([]string{"-ix", "--time", "3"}, "it")
+	if strings.Join(got, " ") != "-ix --time 3" {
+		t.Fatalf("unknown letters must be left alone: %v", got)
+	}
+}
+
+func TestParseKeyValues(t *testing.T) {
+	var l stringList
+	l.Set("max-size=10m")
+	l.Set("max-file=3")
+	m, err := parseKeyValues(l)
+	if err != nil || m["max-size"] != "10m" || m["max-file"] != "3" {
+		t.Fatalf("parseKeyValues = %v, %v", m, err)
+	}
+	if _, err := parseKeyValues([]string{"novalue"}); err == nil {
+		t.Fatalf("expected error for missing =")
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"example.com/containeredu/internal/images"
+)
+
+const containerPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// defaultCommand runs when neither the command line nor the image say
+// what to run.
+const defaultCommand = "/bin/sh"
+
+// applyImageConfig fills in what the command line left open from the
+// image's config, the way docker does: --entrypoint replaces the image's
+// entrypoint and drops its Cmd, --cmd or plain arguments replace its Cmd,
+// -e and --label add to and override its Env and Labels, and --workdir and
+// --user replace its WorkingDir and User.
+func applyImageConfig(opts runOptions, img images.RunConfig) runOptions {
+	entrypoint, cmd := img.Entrypoint, img.Cmd
+	if opts.Entrypoint != "" {
+		entrypoint, cmd = []string{opts.Entrypoint}, nil
+	}
+	if opts.Command != "" {
+		cmd = append([]string{opts.Command}, opts.Args...)
+	} else if len(opts.Args) > 0 {
+		cmd = opts.Args
+	}
+	argv := append(append([]string(nil), entrypoint...), cmd...)
+	if len(argv) == 0 {
+		argv = []string{defaultCommand}
+	}
+	opts.Command, opts.Args = argv[0], argv[1:]
+	opts.Env = mergeEnv(withDefaults(img.Env, "PATH="+containerPath), opts.Env)
+	if opts.WorkingDir == "" {
+		opts.WorkingDir = img.WorkingDir
+	}
+	if opts.User == "" {
+		opts.User = img.User
+	}
+	if len(img.Labels) > 0 {
+		labels := map[string]string{}
+		for k, v := range img.Labels {
+			labels[k] = v
+		}
+		for k, v := range opts.Labels {
+			labels[k] = v
+		}
+		opts.Labels = labels
+	}
+	opts.ExposedPorts = nil
+	for p := range img.ExposedPorts {
+		opts.ExposedPorts = append(opts.ExposedPorts, p)
+	}
+	sort.Strings(opts.ExposedPorts)
+	return opts
+}
+
+func envKey(e string) string {
+	k, _, _ := strings.Cut(e, "=")
+	return k
+}
+
+// envValue returns the value of key in env.
+func envValue(env []string, key string) string {
+	for _, e := range env {
+		if k, v, _ := strings.Cut(e, "="); k == key {
+			return v
+		}
+	}
+	return ""
+}
+
+// mergeEnv returns base with the variables of overrides set, replacing
+// those base already has in place.
+func mergeEnv(base, overrides []string) []string {
+	out := append([]string(nil), base...)
+	for _, o := range overrides {
+		replaced := false
+		for i, e := range out {
+			if envKey(e) == envKey(o) {
+				out[i], replaced = o, true
+			}
+		}
+		if !replaced {
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+// withDefaults returns env with each of defaults added unless env already
+// sets that variable.
+func withDefaults(env []string, defaults ...string) []string {
+	out := append([]string(nil), env...)
+	for _, d := range defaults {
+		if !hasEnv(out, envKey(d)) {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+func hasEnv(env []string, key string) bool {
+	for _, e := range env {
+		if envKey(e) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// parseEnv turns -e values into variables. A bare name takes its value from
+// the CLI's own environment and is left out if it is not set there.
+func parseEnv(values []string) ([]string, error) {
+	var env []string
+	for _, v := range values {
+		k, _, ok := strings.Cut(v, "=")
+		if k == "" {
+			return nil, fmt.Errorf("expected name[=value], got %q", v)
+		}
+		if ok {
+			env = append(env, v)
+		} else if val, set := os.LookupEnv(k); set {
+			env = append(env, k+"="+val)
+		}
+	}
+	return env, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"example.com/containeredu/internal/images"
+)
+
+func TestApplyImageConfig(t *testing.T) {
+	img := images.RunConfig{
+		Entrypoint:   []string{"/entry.sh"},
+		Cmd:          []string{"serve", "--port", "80"},
+		Env:          []string{"PATH=/opt/bin:/bin", "MODE=prod"},
+		WorkingDir:   "/srv",
+		User:         "app",
+		Labels:       map[string]string{"a": "1", "b": "2"},
+		ExposedPorts: map[string]struct{}{"80/tcp": {}, "443/tcp": {}},
+	}
+	cases := []struct {
+		name string
+		opts runOptions
+		img  images.RunConfig
+		argv string
+	}{
+		{"no config", runOptions{}, images.RunConfig{}, "/bin/sh"},
+		{"image", runOptions{}, img, "/entry.sh serve --port 80"},
+		{"args replace cmd", runOptions{Args: []string{"migrate"}}, img, "/entry.sh migrate"},
+		{"--cmd replaces cmd", runOptions{Command: "/bin/sh", Args: []string{"-c", "true"}}, img, "/entry.sh /bin/sh -c true"},
+		{"--entrypoint drops cmd", runOptions{Entrypoint: "/bin/sh"}, img, "/bin/sh"},
+		{"--entrypoint with args", runOptions{Entrypoint: "/bin/echo", Args: []string{"hi"}}, img, "/bin/echo hi"},
+		{"cmd only", runOptions{}, images.RunConfig{Cmd: []string{"/bin/app"}}, "/bin/app"},
+	}
+	for _, c := range cases {
+		got := applyImageConfig(c.opts, c.img)
+		if argv := strings.Join(append([]string{got.Command}, got.Args...), " "); argv != c.argv {
+			t.Errorf("%s: argv = %q, want %q", c.name, argv, c.argv)
+		}
+	}
+
+	got := applyImageConfig(runOptions{}, images.RunConfig{})
+	if !reflect.DeepEqual(got.Env, []string{"PATH=" + containerPath}) || got.WorkingDir != "" || got.User != "" {
+		t.Fatalf("defaults = %+v", got)
+	}
+	got = applyImageConfig(runOptions{
+		Env:        []string{"MODE=dev", "DEBUG=1"},
+		WorkingDir: "/tmp",
+		Labels:     map[string]string{"b": "3"},
+	}, img)
+	if want := []string{"PATH=/opt/bin:/bin", "MODE=dev", "DEBUG=1"}; !reflect.DeepEqual(got.Env, want) {
+		t.Errorf("env = %v, want %v", got.Env, want)
+	}
+	if got.WorkingDir != "/tmp" || got.User != "app" {
+		t.Errorf("workdir %q user %q", got.WorkingDir, got.User)
+	}
+	if want := map[string]string{"a": "1", "b": "3"}; !reflect.DeepEqual(got.Labels, want) {
+		t.Errorf("labels = %v, want %v", got.Labels, want)
+	}
+	if want := []string{"443/tcp", "80/tcp"}; !reflect.DeepEqual(got.ExposedPorts, want) {
+		t.Errorf("ports = %v, want %v", got.ExposedPorts, want)
+	}
+}
+
+func TestParseEnv(t *testing.T) {
+	t.Setenv("CEDE_TEST_SET", "host")
+	env, err := parseEnv([]string{"A=1", "B=", "CEDE_TEST_SET", "CEDE_TEST_UNSET_X"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"A=1", "B=", "CEDE_TEST_SET=host"}; !reflect.DeepEqual(env, want) {
+		t.Fatalf("env = %v, want %v", env, want)
+	}
+	if _, err := parseEnv([]string{"=x"}); err == nil {
+		t.Fatal("empty name accepted")
+	}
+}
@@ -0,0 +1,188 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// childInit runs as PID 1 of a new container. After switching into the
+// rootfs it either execs the workload in its own place (--init=false) or
+// starts it as a child and stays around as a minimal init: it forwards
+// signals to the workload's process group, reaps every child that is
+// re-parented to it and finally exits with the workload's status.
+func childInit() (int, error) {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	rootfs := fs.String("rootfs", "", "")
+	cmdPath := fs.String("cmd", "", "")
+	hostname := fs.String("hostname", "", "")
+	tty := fs.Bool("tty", false, "")
+	useInit := fs.Bool("init", true, "")
+	workdir := fs.String("workdir", "", "")
+	user := fs.String("user", "", "")
+	var tmpfs, binds stringList
+	fs.Var(&tmpfs, "tmpfs", "")
+	fs.Var(&binds, "volume", "")
+	if len(os.Args) < 2 {
+		return -1, fmt.Errorf("init: missing --rootfs or --cmd")
+	}
+	if err := fs.Parse(os.Args[2:]); err != nil {
+		return -1, fmt.Errorf("init: %w", err)
+	}
+	if *rootfs == "" || *cmdPath == "" {
+		return -1, fmt.Errorf("init: missing --rootfs or --cmd")
+	}
+	mounts := append([]mountEntry(nil), defaultMounts...)
+	for _, spec := range tmpfs {
+		m, err := parseTmpfs(spec)
+		if err != nil {
+			return -1, err
+		}
+		mounts = append(mounts, m)
+	}
+	for _, spec := range binds {
+		var v volumeSpec
+		if err := json.Unmarshal([]byte(spec), &v); err != nil {
+			return -1, fmt.Errorf("init: volume %q: %w", spec, err)
+		}
+		mounts = append(mounts, bindMount(v.Source, v.Target, v.ReadOnly))
+	}
+	if err := setupRootfs(*rootfs, mounts); err != nil {
+		return -1, err
+	}
+	if *hostname != "" {
+		_ = syscall.Sethostname([]byte(*hostname))
+	}
+	// the user's passwd entry is the container's, so it is looked up
+	// only now
+	u, err := resolveUser("/", *user)
+	if err != nil {
+		return -1, err
+	}
+	env := withDefaults(os.Environ(), "PATH="+containerPath, "HOSTNAME="+*hostname, "HOME="+u.Home)
+	if *workdir != "" {
+		if err := os.MkdirAll(*workdir, 0o755); err != nil {
+			return -1, fmt.Errorf("workdir: %w", err)
+		}
+		if err := os.Chdir(*workdir); err != nil {
+			return -1, fmt.Errorf("workdir: %w", err)
+		}
+	}
+	path, err := lookPathIn(*cmdPath, envValue(env, "PATH"))
+	if err != nil {
+		return -1, err
+	}
+	argv := append([]string{*cmdPath}, fs.Args()...)
+	if !*useInit {
+		// init is started as a session leader, so it can take the pty
+		// as controlling terminal itself before becoming the workload
+		if *tty {
+			if _, _, e := syscall.RawSyscall(syscall.SYS_IOCTL, 0, syscall.TIOCSCTTY, 0); e != 0 {
+				return -1, fmt.Errorf("set controlling terminal: %w", e)
+			}
+		}
+		if *user != "" {
+			if err := setUser(u); err != nil {
+				return -1, err
+			}
+		}
+		return -1, syscall.Exec(path, argv, env)
+	}
+	// subscribe before the workload exists so that no early signal is
+	// lost and SIGCHLD for a short-lived workload is still seen
+	sigs := make(chan os.Signal, 64)
+	signal.Notify(sigs)
+	cmd := &exec.Cmd{Path: path, Args: argv, Env: env}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if *tty {
+		// a session of its own with the pty on stdin as controlling
+		// terminal, so job control and ^C reach the workload
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+	} else {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
+	if *user != "" {
+		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: u.Uid, Gid: u.Gid, Groups: u.Groups}
+	}
+	if err := cmd.Start(); err != nil {
+		return -1, err
+	}
+	return supervise(cmd.Process.Pid, sigs), nil
+}
+
+// setUser switches this process to u for good.
+func setUser(u execUser) error {
+	groups := make([]int, len(u.Groups))
+	for i, g := range u.Groups {
+		groups[i] = int(g)
+	}
+	if err := syscall.Setgroups(groups); err != nil {
+		return fmt.Errorf("setgroups: %w", err)
+	}
+	if err := syscall.Setgid(int(u.Gid)); err != nil {
+		return fmt.Errorf("setgid: %w", err)
+	}
+	if err := syscall.Setuid(int(u.Uid)); err != nil {
+		return fmt.Errorf("setuid: %w", err)
+	}
+	return nil
+}
+
+// supervise forwards signals to the process group led by child and reaps
+// exited children until child itself is gone, returning the exit code the
+// container should report for it.
+func supervise(child int, sigs chan os.Signal) int {
+	for sig := range sigs {
+		switch sig {
+		case syscall.SIGCHLD:
+			if ws, ok := reap(child); ok {
+				signal.Stop(sigs)
+				if ws.Signaled() {
+					// PID 1 cannot be killed by its own signal, so
+					// report it the way a shell would
+					return 128 + int(ws.Signal())
+				}
+				return ws.ExitStatus()
+			}
+		case syscall.SIGURG:
+			// used internally by the Go runtime for preemption
+		default:
+			s := sig.(syscall.Signal)
+			if err := syscall.Kill(-child, s); err == syscall.ESRCH {
+				// the workload moved itself to another group
+				_ = syscall.Kill(child, s)
+			}
+		}
+	}
+	return -1
+}
+
+// reap collects every exited child without blocking and reports whether
+// child was among them.
+func reap(child int) (syscall.WaitStatus, bool) {
+	var status syscall.WaitStatus
+	found := false
+	for {
+		var ws syscall.WaitStatus
+		pid, err := syscall.Wait4(-1, &ws, syscall.WNOHANG, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil || pid <= 0 {
+			return status, found
+		}
+		if pid == child {
+			status, found = ws, true
+		}
+	}
+}
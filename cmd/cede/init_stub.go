@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+func childInit() (int, error) {
+	return -1, fmt.Errorf("init is only supported on linux")
+}
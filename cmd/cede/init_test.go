@@ -0,0 +1,94 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"testing"
+)
+
+func startSupervised(t *testing.T, args ...string) (int, chan os.Signal) {
+	t.Helper()
+	sigs := make(chan os.Signal, 8)
+	signal.Notify(sigs, syscall.SIGCHLD)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		signal.Stop(sigs)
+		t.Skipf("cannot start %s: %v", args[0], err)
+	}
+	return cmd.Process.Pid, sigs
+}
+
+func TestSuperviseReturnsExitCode(t *testing.T) {
+	pid, sigs := startSupervised(t, "/bin/sh", "-c", "exit 5")
+	if code := supervise(pid, sigs); code != 5 {
+		t.Fatalf("exit code = %d, want 5", code)
+	}
+}
+
+func TestSuperviseForwardsSignals(t *testing.T) {
+	pid, sigs := startSupervised(t, "/bin/sh", "-c", "sleep 30 & wait")
+	sigs <- syscall.SIGTERM
+	if code := supervise(pid, sigs); code != 128+int(syscall.SIGTERM) {
+		t.Fatalf("exit code = %d, want %d", code, 128+int(syscall.SIGTERM))
+	}
+}
+
+func TestSetupRootfsRejectsBadRootfs(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	for _, p := range []string{"/nonexistent/rootfs", f.Name()} {
+		if err := setupRootfs(p, defaultMounts); err == nil {
+			t.Fatalf("setupRootfs(%s) should fail", p)
+		}
+	}
+}
+
+func TestParseTmpfs(t *testing.T) {
+	m, err := parseTmpfs("/run:size=1m,exec,mode=1777")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Target != "/run" || m.FSType != "tmpfs" || m.Data != "size=1m,mode=1777" {
+		t.Fatalf("bad entry: %+v", m)
+	}
+	if m.Flags&syscall.MS_NOEXEC != 0 || m.Flags&syscall.MS_NOSUID == 0 {
+		t.Fatalf("bad flags: %#x", m.Flags)
+	}
+	m, err = parseTmpfs("/cache:ro")
+	if err != nil || m.Flags&syscall.MS_RDONLY == 0 || m.Data != "" {
+		t.Fatalf("ro tmpfs: %+v %v", m, err)
+	}
+	if _, err := parseTmpfs("relative:size=1m"); err == nil {
+		t.Fatalf("relative path should be rejected")
+	}
+}
+
+func TestMkdev(t *testing.T) {
+	if got := mkdev(1, 3); got != 0x103 {
+		t.Fatalf("mkdev(1,3) = %#x", got)
+	}
+	if got := mkdev(5, 0); got != 0x500 {
+		t.Fatalf("mkdev(5,0) = %#x", got)
+	}
+}
+
+func TestParseMountinfo(t *testing.T) {
+	mp, flags, ok := parseMountinfo(`36 35 98:0 / /mnt/with\040space rw,nosuid,nodev,relatime shared:1 - ext4 /dev/root rw`)
+	if !ok || mp != "/mnt/with space" {
+		t.Fatalf("mount point = %q, %v", mp, ok)
+	}
+	if want := uintptr(syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_RELATIME); flags != want {
+		t.Fatalf("flags = %#x, want %#x", flags, want)
+	}
+	if _, _, ok := parseMountinfo(""); ok {
+		t.Fatalf("empty line should not parse")
+	}
+}
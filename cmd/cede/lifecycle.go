@@ -0,0 +1,200 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"example.com/containeredu/internal/cgroups"
+	"example.com/containeredu/internal/id"
+	"example.com/containeredu/internal/netpool"
+	"example.com/containeredu/internal/paths"
+	netplug "example.com/containeredu/internal/plugins/net"
+	"example.com/containeredu/internal/state"
+	"example.com/containeredu/internal/volumes"
+)
+
+var signalNames = map[string]syscall.Signal{
+	"HUP":   syscall.SIGHUP,
+	"INT":   syscall.SIGINT,
+	"QUIT":  syscall.SIGQUIT,
+	"ABRT":  syscall.SIGABRT,
+	"KILL":  syscall.SIGKILL,
+	"USR1":  syscall.SIGUSR1,
+	"USR2":  syscall.SIGUSR2,
+	"PIPE":  syscall.SIGPIPE,
+	"ALRM":  syscall.SIGALRM,
+	"TERM":  syscall.SIGTERM,
+	"CHLD":  syscall.SIGCHLD,
+	"CONT":  syscall.SIGCONT,
+	"STOP":  syscall.SIGSTOP,
+	"TSTP":  syscall.SIGTSTP,
+	"TTIN":  syscall.SIGTTIN,
+	"TTOU":  syscall.SIGTTOU,
+	"WINCH": syscall.SIGWINCH,
+}
+
+// parseSignal accepts a signal number or a name with or without the SIG
+// prefix, e.g. "9", "KILL" or "sigterm".
+func parseSignal(s string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n <= 0 || n > 64 {
+			return 0, fmt.Errorf("invalid signal number: %d", n)
+		}
+		return syscall.Signal(n), nil
+	}
+	name := strings.TrimPrefix(strings.ToUpper(s), "SIG")
+	if sig, ok := signalNames[name]; ok {
+		return sig, nil
+	}
+	return 0, fmt.Errorf("unknown signal: %s", s)
+}
+
+// stopContainer sends SIGTERM to the container's init and escalates to
+// SIGKILL if it is still alive after timeout.
+func stopContainer(ref string, timeout time.Duration) error {
+	st, err := state.Find(ref)
+	if err != nil {
+		return err
+	}
+	if !st.IsActive() {
+		return nil
+	}
+	if err := signalContainer(st, syscall.SIGTERM); err != nil {
+		return err
+	}
+	if waitForExit(st, timeout) {
+		return recordStop(st, syscall.SIGTERM)
+	}
+	if err := signalContainer(st, syscall.SIGKILL); err != nil {
+		return err
+	}
+	if !waitForExit(st, 5*time.Second) {
+		return fmt.Errorf("container %s did not exit after SIGKILL", st.ID)
+	}
+	return recordStop(st, syscall.SIGKILL)
+}
+
+func killContainer(ref string, sig syscall.Signal) error {
+	st, err := state.Find(ref)
+	if err != nil {
+		return err
+	}
+	if !st.IsActive() {
+		return fmt.Errorf("container %s is not running", st.ID)
+	}
+	if err := signalContainer(st, sig); err != nil {
+		return err
+	}
+	// the workload may handle the signal and keep running
+	if waitForExit(st, time.Second) {
+		return recordStop(st, sig)
+	}
+	return nil
+}
+
+func signalContainer(st state.ContainerState, sig syscall.Signal) error {
+	if err := syscall.Kill(st.Pid, sig); err != nil && err != syscall.ESRCH {
+		return fmt.Errorf("signal %d to pid %d: %w", sig, st.Pid, err)
+	}
+	return nil
+}
+
+func waitForExit(st state.ContainerState, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for st.Alive() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return true
+}
+
+// recordStop gives the container's supervisor a moment to record the real
+// exit status and falls back to recording the signal itself, e.g. when the
+// supervising CLI or shim is gone.
+func recordStop(st state.ContainerState, sig syscall.Signal) error {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		cur, err := state.Load(st.ID)
+		if err == nil && !cur.IsActive() {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	st.Status = state.StatusExited
+	st.ExitCode = 128 + int(sig)
+	st.FinishedAt = time.Now()
+	return state.Save(st)
+}
+
+// removeContainer tears down everything run created, in reverse order:
+// network, rootfs mount, cgroup, container directory and finally the state
+// record. Each step tolerates its resource already being gone, so a failed
+// or interrupted removal can simply be retried.
+func removeContainer(ref string, force bool) error {
+	st, err := state.Find(ref)
+	if err != nil {
+		// a record may be missing after a half-finished removal; only a
+		// full container ID may name the leftovers, never a path
+		if !id.Valid(ref) {
+			return err
+		}
+		dir := filepath.Join(paths.ContainersRoot(), ref)
+		if _, serr := os.Stat(dir); serr != nil {
+			return err
+		}
+		st = state.ContainerState{ID: ref, MountDir: filepath.Join(dir, "rootfs")}
+	}
+	if st.IsActive() && st.Alive() {
+		if !force {
+			return fmt.Errorf("container %s is running: stop it first or use -f", st.ID)
+		}
+		if err := signalContainer(st, syscall.SIGKILL); err != nil {
+			return err
+		}
+		if !waitForExit(st, 5*time.Second) {
+			return fmt.Errorf("container %s did not exit after SIGKILL", st.ID)
+		}
+	}
+	if st.Net != "" {
+		if p := netplug.Get(st.Net); p != nil {
+			if err := p.Teardown(st.ID); err != nil {
+				return err
+			}
+		}
+	}
+	if err := netpool.Release(st.ID); err != nil {
+		return fmt.Errorf("release ip: %w", err)
+	}
+	driver, err := containerStorage(st)
+	if err != nil {
+		return err
+	}
+	if err := driver.Remove(st.ID); err != nil {
+		return err
+	}
+	if err := cgroups.Remove(st.ID); err != nil {
+		return err
+	}
+	if err := volumes.ReleaseContainer(st.ID); err != nil {
+		return fmt.Errorf("release volumes: %w", err)
+	}
+	if err := os.RemoveAll(filepath.Join(paths.ContainersRoot(), st.ID)); err != nil {
+		return err
+	}
+	if err := state.Remove(st.ID); err != nil {
+		return err
+	}
+	if st.Image != "" {
+		pruneLegacyLayers(st.Image)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+)
+
+func parseSignal(s string) (syscall.Signal, error) {
+	return 0, fmt.Errorf("signals are only supported on linux")
+}
+
+func stopContainer(ref string, timeout time.Duration) error {
+	return fmt.Errorf("stop is only supported on linux")
+}
+
+func removeContainer(ref string, force bool) error {
+	return fmt.Errorf("rm is only supported on linux")
+}
+
+func killContainer(ref string, sig syscall.Signal) error {
+	return fmt.Errorf("kill is only supported on linux")
+}
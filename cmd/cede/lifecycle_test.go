@@ -0,0 +1,197 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"example.com/containeredu/internal/paths"
+	"example.com/containeredu/internal/state"
+)
+
+func TestParseSignal(t *testing.T) {
+	cases := map[string]syscall.Signal{
+		"9":       syscall.SIGKILL,
+		"TERM":    syscall.SIGTERM,
+		"sigterm": syscall.SIGTERM,
+		"SIGHUP":  syscall.SIGHUP,
+	}
+	for in, want := range cases {
+		got, err := parseSignal(in)
+		if err != nil || got != want {
+			t.Fatalf("parseSignal(%q) = %v, %v", in, got, err)
+		}
+	}
+	for _, bad := range []string{"", "0", "NOPE", "99"} {
+		if _, err := parseSignal(bad); err == nil {
+			t.Fatalf("parseSignal(%q) should fail", bad)
+		}
+	}
+}
+
+func TestStopContainerRecordsExit(t *testing.T) {
+	tmp := t.TempDir()
+	os.Setenv("HOME", tmp)
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("sleep unavailable: %v", err)
+	}
+	// reap in the background like a supervisor would, without recording
+	go cmd.Wait()
+	start, _ := state.ProcessStartTime(cmd.Process.Pid)
+	st := state.ContainerState{ID: "stopme-1234", Pid: cmd.Process.Pid, PidStartTime: start, Status: state.StatusRunning}
+	if err := state.Save(st); err != nil {
+		t.Fatal(err)
+	}
+	if err := stopContainer("stopme", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	got, err := state.Load(st.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != state.StatusExited || got.ExitCode != 128+int(syscall.SIGTERM) {
+		t.Fatalf("unexpected state after stop: %+v", got)
+	}
+	if err := killContainer("stopme", syscall.SIGKILL); err == nil {
+		t.Fatalf("kill of a stopped container should fail")
+	}
+}
+
+func TestWaitContainerKeepsOtherFields(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	st := state.ContainerState{ID: "wait-1234", Status: state.StatusRunning}
+	if err := state.Save(st); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("sh", "-c", "exit 3")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("sh unavailable: %v", err)
+	}
+	// written by someone else while the container runs
+	cur := st
+	cur.IP = "10.0.0.2"
+	if err := state.Save(cur); err != nil {
+		t.Fatal(err)
+	}
+	waitContainer(&st, cmd)
+	got, err := state.Load(st.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.IP != "10.0.0.2" || got.Status != state.StatusExited || got.ExitCode != 3 {
+		t.Fatalf("unexpected state after wait: %+v", got)
+	}
+
+	// a container removed while it ran stays removed
+	if err := state.Remove(st.ID); err != nil {
+		t.Fatal(err)
+	}
+	cmd = exec.Command("sh", "-c", "exit 0")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitContainer(&st, cmd)
+	if _, err := state.Load(st.ID); !os.IsNotExist(err) {
+		t.Fatalf("removed record came back: %v", err)
+	}
+}
+
+func TestRemoveContainerIsIdempotent(t *testing.T) {
+	tmp := t.TempDir()
+	os.Setenv("HOME", tmp)
+	t.Setenv("CEDE_CGROUP_ROOT", filepath.Join(tmp, "cgroup"))
+	id := "3f0c9a52-6d1e-4b7a-9c2f-5e8d7b6a4c31"
+	dir := filepath.Join(paths.ContainersRoot(), id)
+	if err := os.MkdirAll(filepath.Join(dir, "rootfs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	st := state.ContainerState{ID: id, Status: state.StatusExited, MountDir: filepath.Join(dir, "rootfs")}
+	if err := state.Save(st); err != nil {
+		t.Fatal(err)
+	}
+	// a running record needs -f
+	running := st
+	running.Status = state.StatusRunning
+	running.Pid = os.Getpid()
+	if err := state.Save(running); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeContainer("3f0c9a52", false); err == nil {
+		t.Fatalf("expected error removing a running container without -f")
+	}
+	if err := state.Save(st); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeContainer("3f0c9a52", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("container dir left behind: %v", err)
+	}
+	if _, err := state.Load(id); err == nil {
+		t.Fatalf("state record left behind")
+	}
+	// half-removed: directory without a record
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeContainer(id, false); err != nil {
+		t.Fatalf("removing leftover dir: %v", err)
+	}
+	if err := removeContainer(id, false); err == nil {
+		t.Fatalf("expected not found once everything is gone")
+	}
+	// without a record only a full ID names a directory to remove
+	if err := paths.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range []string{"3f0c9a52", "..", "../images", "", id + "/.."} {
+		if err := removeContainer(ref, true); err == nil {
+			t.Errorf("removeContainer(%q) succeeded", ref)
+		}
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Fatalf("container dir removed: %v", err)
+	}
+	if _, err := os.Stat(paths.ImagesRoot()); err != nil {
+		t.Fatalf("images root removed: %v", err)
+	}
+}
+
+func TestExecRequiresRunningContainer(t *testing.T) {
+	tmp := t.TempDir()
+	os.Setenv("HOME", tmp)
+	if err := state.Save(state.ContainerState{ID: "idle-0001", Status: state.StatusExited}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := execInContainer("idle", []string{"/bin/true"}, false, false); err == nil {
+		t.Fatalf("exec into a stopped container should fail")
+	}
+}
+
+func TestLookPathIn(t *testing.T) {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "tool")
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	p, err := lookPathIn("tool", "/nonexistent:"+dir)
+	if err != nil || p != bin {
+		t.Fatalf("lookPathIn = %q, %v", p, err)
+	}
+	if p, _ := lookPathIn("/abs/path", ""); p != "/abs/path" {
+		t.Fatalf("absolute path changed: %q", p)
+	}
+	if _, err := lookPathIn("missing", dir); err == nil {
+		t.Fatalf("expected error for missing command")
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"example.com/containeredu/internal/logs"
+	"example.com/containeredu/internal/plugins/logging"
+	_ "example.com/containeredu/internal/plugins/logging/jsonfile"
+	_ "example.com/containeredu/internal/plugins/logging/none"
+	_ "example.com/containeredu/internal/plugins/logging/syslog"
+	"example.com/containeredu/internal/state"
+)
+
+// containerLog feeds a container's stdout and stderr to its log driver.
+type containerLog struct {
+	logger logging.Logger
+	stdout *logs.LineWriter
+	stderr *logs.LineWriter
+}
+
+func logDriver(name string) (logging.Driver, error) {
+	if name == "" {
+		name = logging.DefaultDriver
+	}
+	d := logging.Get(name)
+	if d == nil {
+		return nil, fmt.Errorf("unknown log driver: %s", name)
+	}
+	return d, nil
+}
+
+func openContainerLog(containerID, driver string, opts map[string]string) (*containerLog, error) {
+	d, err := logDriver(driver)
+	if err != nil {
+		return nil, err
+	}
+	l, err := d.New(containerID, opts)
+	if err != nil {
+		return nil, fmt.Errorf("open log: %w", err)
+	}
+	return newContainerLog(l, os.Stderr), nil
+}
+
+func newContainerLog(l logging.Logger, errOut io.Writer) *containerLog {
+	return &containerLog{
+		logger: l,
+		stdout: logs.NewLineWriter("stdout", dropErrors(l, errOut)),
+		stderr: logs.NewLineWriter("stderr", dropErrors(l, errOut)),
+	}
+}
+
+// dropErrors logs to l, reporting failures on errOut instead of returning
+// them: the writers feed an io.MultiWriter that also copies the output to
+// the terminal, and it stops at the first error. Only the first of a run
+// of failures is reported.
+func dropErrors(l logging.Logger, errOut io.Writer) func(logs.Entry) error {
+	failing := false
+	return func(e logs.Entry) error {
+		err := l.Log(e)
+		if err != nil && !failing {
+			fmt.Fprintf(errOut, "log driver: %v; dropping log entries\n", err)
+		}
+		failing = err != nil
+		return nil
+	}
+}
+
+// Close flushes partial lines; call it only after the container's output
+// pipes have been drained.
+func (l *containerLog) Close() error {
+	l.stdout.Close()
+	l.stderr.Close()
+	return l.logger.Close()
+}
+
+func showLogs(ref string, follow bool, tail int, since string, timestamps bool) error {
+	st, err := state.Find(ref)
+	if err != nil {
+		return err
+	}
+	// containers created before log drivers existed have no options file
+	opts, _ := loadRunOptions(st.ID)
+	d, err := logDriver(opts.LogDriver)
+	if err != nil {
+		return err
+	}
+	r, ok := d.(logging.Reader)
+	if !ok {
+		return fmt.Errorf("logs are not available with the %s log driver", d.Name())
+	}
+	sinceT, err := parseSince(since, time.Now())
+	if err != nil {
+		return err
+	}
+	readOpts := logs.ReadOptions{
+		Tail:   tail,
+		Since:  sinceT,
+		Follow: follow,
+		Done: func() bool {
+			cur, err := state.Load(st.ID)
+			return err != nil || !cur.IsActive() || !cur.Alive()
+		},
+	}
+	return r.Read(st.ID, readOpts, func(e logs.Entry) error {
+		var w io.Writer = os.Stdout
+		if e.Stream == "stderr" {
+			w = os.Stderr
+		}
+		if timestamps {
+			fmt.Fprintf(w, "%s ", e.Time.Format(time.RFC3339Nano))
+		}
+		_, err := io.WriteString(w, e.Log)
+		return err
+	})
+}
+
+// parseSince accepts an RFC 3339 timestamp, a unix timestamp in seconds or
+// a duration such as 10m that is taken relative to now.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(n, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since value: %s", s)
+}
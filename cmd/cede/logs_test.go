@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/containeredu/internal/logs"
+	"example.com/containeredu/internal/state"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	cases := map[string]time.Time{
+		"":                     {},
+		"10m":                  now.Add(-10 * time.Minute),
+		"2024-05-01T11:00:00Z": time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC),
+		"1714561200":           time.Unix(1714561200, 0),
+	}
+	for in, want := range cases {
+		got, err := parseSince(in, now)
+		if err != nil || !got.Equal(want) {
+			t.Fatalf("parseSince(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := parseSince("yesterday", now); err == nil {
+		t.Fatalf("expected error for invalid value")
+	}
+}
+
+func TestContainerLogCapturesStreams(t *testing.T) {
+	tmp := t.TempDir()
+	os.Setenv("HOME", tmp)
+	clog, err := openContainerLog("logged", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clog.stdout.Write([]byte("out line\npartial"))
+	clog.stderr.Write([]byte("err line\n"))
+	if err := clog.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var got []logs.Entry
+	if err := logs.Read(logs.Path("logged"), logs.ReadOptions{Tail: -1}, func(e logs.Entry) error {
+		got = append(got, e)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0].Stream != "stdout" || got[1].Stream != "stderr" || got[2].Log != "partial" {
+		t.Fatalf("unexpected log entries: %+v", got)
+	}
+}
+
+type failingLogger struct{ calls int }
+
+func (l *failingLogger) Log(logs.Entry) error {
+	l.calls++
+	return errors.New("disk full")
+}
+
+func (l *failingLogger) Close() error { return nil }
+
+func TestContainerLogDropsDriverErrors(t *testing.T) {
+	l := &failingLogger{}
+	var out, errOut bytes.Buffer
+	clog := newContainerLog(l, &errOut)
+	w := io.MultiWriter(&out, clog.stdout)
+	for _, s := range []string{"one\n", "two\n", "three\n"} {
+		if _, err := w.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if out.String() != "one\ntwo\nthree\n" || l.calls != 3 {
+		t.Fatalf("output %q after %d log calls", out.String(), l.calls)
+	}
+	if n := strings.Count(errOut.String(), "disk full"); n != 1 {
+		t.Fatalf("reported %d times: %q", n, errOut.String())
+	}
+}
+
+func TestShowLogsRequiresReadableDriver(t *testing.T) {
+	tmp := t.TempDir()
+	os.Setenv("HOME", tmp)
+	if err := state.Save(state.ContainerState{ID: "quiet-1", Status: state.StatusExited}); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveRunOptions("quiet-1", runOptions{LogDriver: "none"}); err != nil {
+		t.Fatal(err)
+	}
+	err := showLogs("quiet", false, -1, "", false)
+	if err == nil || !strings.Contains(err.Error(), "none log driver") {
+		t.Fatalf("expected driver error, got %v", err)
+	}
+	if _, err := openContainerLog("quiet-1", "bogus", nil); err == nil {
+		t.Fatalf("expected unknown driver error")
+	}
+}
@@ -4,15 +4,26 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
+
+	"example.com/containeredu/internal/plugins/logging"
+	"example.com/containeredu/internal/volumes"
 )
 
 func usage() {
 	fmt.Fprintf(os.Stderr, "ContainerEdu (cede) - a simplified Docker-like engine\n")
 	fmt.Fprintf(os.Stderr, "Usage:\n")
-	fmt.Fprintf(os.Stderr, "  cede run --image <name> [--cmd <path>] [args...]\n")
+	fmt.Fprintf(os.Stderr, "  cede run [-dt] [--rm] [--init=false] [-v src:/path[:ro]] [--tmpfs /path[:opts]] [--storage-driver <name>] [--log-driver <name>] [--log-opt k=v] [-e NAME[=value]] [--entrypoint <path>] [--workdir <dir>] [--user <user[:group]>] [--label k=v] --image <name> [--cmd <path>] [args...]\n")
 	fmt.Fprintf(os.Stderr, "  cede build --dockerfile <path> --tag <name>\n")
-	fmt.Fprintf(os.Stderr, "  cede ps\n")
-	fmt.Fprintf(os.Stderr, "  cede pull --tar <path>\n")
+	fmt.Fprintf(os.Stderr, "  cede ps [-s]\n")
+	fmt.Fprintf(os.Stderr, "  cede stop <id> [--time N]\n")
+	fmt.Fprintf(os.Stderr, "  cede kill <id> [--signal X]\n")
+	fmt.Fprintf(os.Stderr, "  cede rm [-f] <id>\n")
+	fmt.Fprintf(os.Stderr, "  cede exec [-it] <id> <cmd> [args...]\n")
+	fmt.Fprintf(os.Stderr, "  cede logs <id> [--follow] [--tail N] [--since T] [--timestamps]\n")
+	fmt.Fprintf(os.Stderr, "  cede pull --tar <path|-> [--name <name>]\n")
+	fmt.Fprintf(os.Stderr, "  cede verify <image>...\n")
+	fmt.Fprintf(os.Stderr, "  cede volume create [name] | ls | inspect <name>... | rm <name>...\n")
 	fmt.Fprintf(os.Stderr, "  cede net ls | release --id <containerID>\n")
 	fmt.Fprintf(os.Stderr, "  cede net config --cidr <CIDR> --gateway <IP>\n")
 }
@@ -27,27 +38,82 @@ func main() {
 	case "run":
 		runCmd := flag.NewFlagSet("run", flag.ExitOnError)
 		image := runCmd.String("image", "", "image name to run")
-		command := runCmd.String("cmd", "/bin/sh", "command to execute in container")
+		command := runCmd.String("cmd", "", "command to execute in container instead of the image's Cmd (default from the image, else /bin/sh)")
+		entrypoint := runCmd.String("entrypoint", "", "replace the image's entrypoint (and drop its Cmd)")
+		workdir := runCmd.String("workdir", "", "working directory inside the container (default from the image)")
+		user := runCmd.String("user", "", "user[:group] to run as, by name or ID (default from the image)")
 		hostname := runCmd.String("hostname", "cede", "UTS hostname inside container")
 		netPlugin := runCmd.String("net", "", "optional network plugin name")
 		cpuMax := runCmd.String("cpu", "100000 100000", "cgroup v2 cpu.max (quota period)")
 		memMax := runCmd.String("mem", "256M", "cgroup v2 memory.max")
 		pidsMax := runCmd.Int("pids", 64, "cgroup v2 pids.max")
-		_ = hostname
-		_ = netPlugin
-		_ = cpuMax
-		_ = memMax
-		_ = pidsMax
-		runCmd.Parse(os.Args[2:])
+		detach := runCmd.Bool("d", false, "run container in the background and print its ID")
+		autoRemove := runCmd.Bool("rm", false, "remove the container when it exits")
+		storageDriverName := runCmd.String("storage-driver", "", "storage driver for the container filesystem (default from the data root's storage.json, else overlay)")
+		var vols, tmpfs, envs, labels stringList
+		runCmd.Var(&envs, "e", "set an environment variable NAME=value, or pass NAME through from this environment (repeatable)")
+		runCmd.Var(&labels, "label", "set a container label key=value on top of the image's (repeatable)")
+		runCmd.Var(&vols, "v", "bind mount host:container[:ro] or mount named volume name:container[:ro] (repeatable)")
+		runCmd.Var(&tmpfs, "tmpfs", "mount a tmpfs at /path[:opts] inside the container (repeatable)")
+		useInit := runCmd.Bool("init", true, "run a minimal init as PID 1 that forwards signals and reaps zombies")
+		tty := runCmd.Bool("t", false, "allocate a pseudo-terminal for the container")
+		logDriverName := runCmd.String("log-driver", logging.DefaultDriver, "log driver: json-file, syslog or none")
+		var logOpts stringList
+		runCmd.Var(&logOpts, "log-opt", "log driver option key=value (repeatable)")
+		runCmd.Parse(expandShortFlags(os.Args[2:], "dt"))
 		args := runCmd.Args()
 		if *image == "" {
 			fmt.Fprintf(os.Stderr, "run: --image is required\n")
 			os.Exit(2)
 		}
-		if err := runContainer(*image, *command, args, *hostname, *netPlugin, *cpuMax, *memMax, *pidsMax); err != nil {
+		logOptMap, err := parseKeyValues(logOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "run: --log-opt: %v\n", err)
+			os.Exit(2)
+		}
+		env, err := parseEnv(envs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "run: -e: %v\n", err)
+			os.Exit(2)
+		}
+		labelMap, err := parseKeyValues(labels)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "run: --label: %v\n", err)
+			os.Exit(2)
+		}
+		opts := runOptions{
+			Image:    *image,
+			Command:  *command,
+			Args:     args,
+			Hostname: *hostname,
+			Net:      *netPlugin,
+			CPUMax:   *cpuMax,
+			MemMax:   *memMax,
+			PidsMax:  *pidsMax,
+			Detach:   *detach,
+			Remove:   *autoRemove,
+			TTY:      *tty,
+			NoInit:   !*useInit,
+			Volumes:  vols,
+			Tmpfs:    tmpfs,
+
+			StorageDriver: *storageDriverName,
+
+			LogDriver: *logDriverName,
+			LogOpts:   logOptMap,
+
+			Entrypoint: *entrypoint,
+			Env:        env,
+			WorkingDir: *workdir,
+			User:       *user,
+			Labels:     labelMap,
+		}
+		code, err := runContainer(opts)
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "run error: %v\n", err)
-			os.Exit(1)
+			os.Exit(125)
 		}
+		os.Exit(code)
 	case "build":
 		buildCmd := flag.NewFlagSet("build", flag.ExitOnError)
 		dockerfile := buildCmd.String("dockerfile", "Dockerfile.cede", "path to simplified Dockerfile")
@@ -62,23 +128,181 @@ func main() {
 			os.Exit(1)
 		}
 	case "ps":
-		if err := listContainers(); err != nil {
+		psCmd := flag.NewFlagSet("ps", flag.ExitOnError)
+		size := psCmd.Bool("s", false, "show the size each container has written")
+		psCmd.Parse(os.Args[2:])
+		if err := listContainers(*size); err != nil {
 			fmt.Fprintf(os.Stderr, "ps error: %v\n", err)
 			os.Exit(1)
 		}
+	case "stop":
+		stopCmd := flag.NewFlagSet("stop", flag.ExitOnError)
+		timeout := stopCmd.Int("time", 10, "seconds to wait for exit before sending SIGKILL")
+		ids := parseInterspersed(stopCmd, os.Args[2:])
+		if len(ids) == 0 {
+			fmt.Fprintf(os.Stderr, "stop: container id is required\n")
+			os.Exit(2)
+		}
+		failed := false
+		for _, ref := range ids {
+			if err := stopContainer(ref, time.Duration(*timeout)*time.Second); err != nil {
+				fmt.Fprintf(os.Stderr, "stop error: %v\n", err)
+				failed = true
+				continue
+			}
+			fmt.Println(ref)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	case "kill":
+		killCmd := flag.NewFlagSet("kill", flag.ExitOnError)
+		signal := killCmd.String("signal", "KILL", "signal name or number to send")
+		ids := parseInterspersed(killCmd, os.Args[2:])
+		if len(ids) == 0 {
+			fmt.Fprintf(os.Stderr, "kill: container id is required\n")
+			os.Exit(2)
+		}
+		sig, err := parseSignal(*signal)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "kill: %v\n", err)
+			os.Exit(2)
+		}
+		failed := false
+		for _, ref := range ids {
+			if err := killContainer(ref, sig); err != nil {
+				fmt.Fprintf(os.Stderr, "kill error: %v\n", err)
+				failed = true
+				continue
+			}
+			fmt.Println(ref)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	case "rm":
+		rmCmd := flag.NewFlagSet("rm", flag.ExitOnError)
+		force := rmCmd.Bool("f", false, "kill the container first if it is running")
+		ids := parseInterspersed(rmCmd, os.Args[2:])
+		if len(ids) == 0 {
+			fmt.Fprintf(os.Stderr, "rm: container id is required\n")
+			os.Exit(2)
+		}
+		failed := false
+		for _, ref := range ids {
+			if err := removeContainer(ref, *force); err != nil {
+				fmt.Fprintf(os.Stderr, "rm error: %v\n", err)
+				failed = true
+				continue
+			}
+			fmt.Println(ref)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	case "exec":
+		execCmd := flag.NewFlagSet("exec", flag.ExitOnError)
+		interactive := execCmd.Bool("i", false, "keep stdin attached")
+		tty := execCmd.Bool("t", false, "attach a terminal")
+		execCmd.Parse(expandShortFlags(os.Args[2:], "it"))
+		args := execCmd.Args()
+		if len(args) < 2 {
+			fmt.Fprintf(os.Stderr, "exec: container id and command are required\n")
+			os.Exit(2)
+		}
+		code, err := execInContainer(args[0], args[1:], *interactive, *tty)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "exec error: %v\n", err)
+			os.Exit(126)
+		}
+		os.Exit(code)
+	case "logs":
+		logsCmd := flag.NewFlagSet("logs", flag.ExitOnError)
+		follow := logsCmd.Bool("follow", false, "keep streaming new output until the container exits")
+		tail := logsCmd.Int("tail", -1, "number of lines to show from the end (-1 for all)")
+		since := logsCmd.String("since", "", "show lines since a timestamp (RFC 3339, unix seconds) or duration (e.g. 10m)")
+		timestamps := logsCmd.Bool("timestamps", false, "prefix each line with its timestamp")
+		ids := parseInterspersed(logsCmd, os.Args[2:])
+		if len(ids) != 1 {
+			fmt.Fprintf(os.Stderr, "logs: exactly one container id is required\n")
+			os.Exit(2)
+		}
+		if err := showLogs(ids[0], *follow, *tail, *since, *timestamps); err != nil {
+			fmt.Fprintf(os.Stderr, "logs error: %v\n", err)
+			os.Exit(1)
+		}
 	case "pull":
 		pullCmd := flag.NewFlagSet("pull", flag.ExitOnError)
-		tar := pullCmd.String("tar", "", "path to docker save tarball")
-		name := pullCmd.String("name", "", "image name to register")
+		tar := pullCmd.String("tar", "", "docker save or OCI layout tarball (- for stdin), or OCI layout directory")
+		name := pullCmd.String("name", "", "image name to register instead of the names in the archive")
 		pullCmd.Parse(os.Args[2:])
-		if *tar == "" || *name == "" {
-			fmt.Fprintf(os.Stderr, "pull: --tar and --name are required\n")
+		if *tar == "" {
+			fmt.Fprintf(os.Stderr, "pull: --tar is required\n")
 			os.Exit(2)
 		}
 		if err := importImageTar(*tar, *name); err != nil {
 			fmt.Fprintf(os.Stderr, "pull error: %v\n", err)
 			os.Exit(1)
 		}
+	case "verify":
+		if len(os.Args) < 3 {
+			fmt.Fprintf(os.Stderr, "verify: image name is required\n")
+			os.Exit(2)
+		}
+		if err := verifyImages(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "verify error: %v\n", err)
+			os.Exit(1)
+		}
+	case "volume":
+		if len(os.Args) < 3 {
+			usage()
+			os.Exit(2)
+		}
+		switch os.Args[2] {
+		case "create":
+			name := ""
+			if len(os.Args) > 3 {
+				name = os.Args[3]
+			}
+			if err := volumeCreate(name); err != nil {
+				fmt.Fprintf(os.Stderr, "volume create error: %v\n", err)
+				os.Exit(1)
+			}
+		case "ls":
+			if err := volumeList(); err != nil {
+				fmt.Fprintf(os.Stderr, "volume ls error: %v\n", err)
+				os.Exit(1)
+			}
+		case "inspect":
+			if len(os.Args) < 4 {
+				fmt.Fprintf(os.Stderr, "volume inspect: volume name is required\n")
+				os.Exit(2)
+			}
+			if err := volumeInspect(os.Args[3:]); err != nil {
+				fmt.Fprintf(os.Stderr, "volume inspect error: %v\n", err)
+				os.Exit(1)
+			}
+		case "rm":
+			if len(os.Args) < 4 {
+				fmt.Fprintf(os.Stderr, "volume rm: volume name is required\n")
+				os.Exit(2)
+			}
+			failed := false
+			for _, name := range os.Args[3:] {
+				if err := volumes.Remove(name); err != nil {
+					fmt.Fprintf(os.Stderr, "volume rm error: %v\n", err)
+					failed = true
+					continue
+				}
+				fmt.Println(name)
+			}
+			if failed {
+				os.Exit(1)
+			}
+		default:
+			usage()
+			os.Exit(2)
+		}
 	case "net":
 		if len(os.Args) < 3 {
 			usage()
@@ -120,11 +344,21 @@ func main() {
 			usage()
 			os.Exit(2)
 		}
+	case "shim":
+		shimCmd := flag.NewFlagSet("shim", flag.ExitOnError)
+		id := shimCmd.String("id", "", "container id to supervise")
+		readyFD := shimCmd.Int("ready-fd", -1, "fd closed once the container has started")
+		shimCmd.Parse(os.Args[2:])
+		if err := runShim(*id, *readyFD); err != nil {
+			os.Exit(1)
+		}
 	case "init":
-		if err := childInit(); err != nil {
+		code, err := childInit()
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "init error: %v\n", err)
-			os.Exit(1)
+			os.Exit(127)
 		}
+		os.Exit(code)
 	default:
 		usage()
 		os.Exit(1)
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"example.com/containeredu/internal/paths"
+)
+
+// runOptions holds everything `cede run` needs to start a container. It is
+// persisted next to the container so a detached shim can pick it up.
+type runOptions struct {
+	Image    string   `json:"image"`
+	Command  string   `json:"command"`
+	Args     []string `json:"args"`
+	Hostname string   `json:"hostname"`
+	Net      string   `json:"net"`
+	CPUMax   string   `json:"cpu_max"`
+	MemMax   string   `json:"mem_max"`
+	PidsMax  int      `json:"pids_max"`
+	Detach   bool     `json:"detach"`
+	Remove   bool     `json:"remove"`
+	TTY      bool     `json:"tty"`
+	NoInit   bool     `json:"no_init"`
+	Volumes  []string `json:"volumes,omitempty"`
+	Tmpfs    []string `json:"tmpfs,omitempty"`
+
+	StorageDriver string `json:"storage_driver"`
+
+	LogDriver string            `json:"log_driver"`
+	LogOpts   map[string]string `json:"log_opts,omitempty"`
+
+	// Entrypoint replaces the image's entrypoint; Command and Args are the
+	// whole command line once the image config has been applied.
+	Entrypoint   string            `json:"entrypoint,omitempty"`
+	Env          []string          `json:"env,omitempty"`
+	WorkingDir   string            `json:"working_dir,omitempty"`
+	User         string            `json:"user,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	ExposedPorts []string          `json:"exposed_ports,omitempty"`
+}
+
+func runOptionsPath(containerID string) string {
+	return filepath.Join(paths.ContainersRoot(), containerID, "config.json")
+}
+
+func saveRunOptions(containerID string, opts runOptions) error {
+	p := runOptionsPath(containerID)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	b, _ := json.MarshalIndent(opts, "", "  ")
+	// it holds the container's environment
+	return os.WriteFile(p, b, 0o600)
+}
+
+func loadRunOptions(containerID string) (runOptions, error) {
+	var opts runOptions
+	b, err := os.ReadFile(runOptionsPath(containerID))
+	if err != nil {
+		return opts, err
+	}
+	if err := json.Unmarshal(b, &opts); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
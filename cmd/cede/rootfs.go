@@ -0,0 +1,326 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"example.com/containeredu/internal/paths"
+)
+
+// mountEntry is one filesystem mounted into the rootfs by init. Target is
+// the path as seen from inside the container.
+type mountEntry struct {
+	Source string
+	Target string
+	FSType string
+	Flags  uintptr
+	Data   string
+}
+
+const msDefault = syscall.MS_NOSUID | syscall.MS_NOEXEC | syscall.MS_NODEV
+
+// defaultMounts is the table of filesystems every container gets, in mount
+// order; parents must come before their children.
+var defaultMounts = []mountEntry{
+	{"proc", "/proc", "proc", msDefault, ""},
+	{"tmpfs", "/dev", "tmpfs", syscall.MS_NOSUID | syscall.MS_STRICTATIME, "mode=755,size=65536k"},
+	{"devpts", "/dev/pts", "devpts", syscall.MS_NOSUID | syscall.MS_NOEXEC, "newinstance,ptmxmode=0666,mode=0620,gid=5"},
+	{"shm", "/dev/shm", "tmpfs", msDefault, "mode=1777,size=65536k"},
+	{"mqueue", "/dev/mqueue", "mqueue", msDefault, ""},
+	{"sysfs", "/sys", "sysfs", msDefault | syscall.MS_RDONLY, ""},
+}
+
+// devices are the character devices created in the container's /dev.
+var devices = []struct {
+	name         string
+	major, minor uint32
+}{
+	{"null", 1, 3},
+	{"zero", 1, 5},
+	{"full", 1, 7},
+	{"random", 1, 8},
+	{"urandom", 1, 9},
+	{"tty", 5, 0},
+}
+
+var devSymlinks = [][2]string{
+	{"/proc/self/fd", "/dev/fd"},
+	{"/proc/self/fd/0", "/dev/stdin"},
+	{"/proc/self/fd/1", "/dev/stdout"},
+	{"/proc/self/fd/2", "/dev/stderr"},
+	{"pts/ptmx", "/dev/ptmx"},
+}
+
+// mountOptions maps the generic options accepted by --tmpfs to mount flags;
+// anything else is handed to the filesystem as data.
+var mountOptions = map[string]struct {
+	clear bool
+	flag  uintptr
+}{
+	"ro":     {false, syscall.MS_RDONLY},
+	"rw":     {true, syscall.MS_RDONLY},
+	"noexec": {false, syscall.MS_NOEXEC},
+	"exec":   {true, syscall.MS_NOEXEC},
+	"nosuid": {false, syscall.MS_NOSUID},
+	"suid":   {true, syscall.MS_NOSUID},
+	"nodev":  {false, syscall.MS_NODEV},
+	"dev":    {true, syscall.MS_NODEV},
+	"sync":   {false, syscall.MS_SYNCHRONOUS},
+	"async":  {true, syscall.MS_SYNCHRONOUS},
+}
+
+// parseTmpfs parses a --tmpfs value of the form /path[:opt,opt,...]. Like
+// docker, the mount is noexec, nosuid and nodev unless told otherwise.
+func parseTmpfs(spec string) (mountEntry, error) {
+	target, opts, _ := strings.Cut(spec, ":")
+	if !filepath.IsAbs(target) {
+		return mountEntry{}, fmt.Errorf("tmpfs %q: path must be absolute", spec)
+	}
+	m := mountEntry{Source: "tmpfs", Target: filepath.Clean(target), FSType: "tmpfs", Flags: msDefault}
+	var data []string
+	for _, o := range strings.Split(opts, ",") {
+		if o == "" {
+			continue
+		}
+		if mo, ok := mountOptions[o]; ok {
+			if mo.clear {
+				m.Flags &^= mo.flag
+			} else {
+				m.Flags |= mo.flag
+			}
+			continue
+		}
+		data = append(data, o)
+	}
+	m.Data = strings.Join(data, ",")
+	return m, nil
+}
+
+// setupRootfs mounts everything in mounts into rootfs, populates /dev and
+// makes rootfs the root of the current mount namespace.
+func setupRootfs(rootfs string, mounts []mountEntry) error {
+	// check first so a bad path fails before any mount is touched
+	fi, err := os.Stat(rootfs)
+	if err != nil {
+		return fmt.Errorf("rootfs: %w", err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("rootfs %s is not a directory", rootfs)
+	}
+	// the namespace starts as a copy of the host's; stop mount events
+	// from flowing back to the host before changing anything
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make / private: %w", err)
+	}
+	// pivot_root needs the new root to be a mount point
+	if err := syscall.Mount(rootfs, rootfs, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("bind rootfs: %w", err)
+	}
+	for _, m := range mounts {
+		if err := mountInto(rootfs, m); err != nil {
+			return err
+		}
+	}
+	if err := populateDev(rootfs); err != nil {
+		return err
+	}
+	return switchRoot(rootfs)
+}
+
+// bindMount describes a bind mount of a host path. It is read-only if
+// readOnly is set.
+func bindMount(source, target string, readOnly bool) mountEntry {
+	m := mountEntry{Source: source, Target: target, FSType: "bind", Flags: syscall.MS_BIND | syscall.MS_REC}
+	if readOnly {
+		m.Flags |= syscall.MS_RDONLY
+	}
+	return m
+}
+
+func mountInto(rootfs string, m mountEntry) error {
+	target, err := paths.SecureJoin(rootfs, m.Target)
+	if err != nil {
+		return err
+	}
+	isBind := m.Flags&syscall.MS_BIND != 0
+	if err := mkMountpoint(m, target, isBind); err != nil {
+		return fmt.Errorf("mount %s: %w", m.Target, err)
+	}
+	if !isBind {
+		if err := syscall.Mount(m.Source, target, m.FSType, m.Flags, m.Data); err != nil {
+			return fmt.Errorf("mount %s on %s: %w", m.FSType, m.Target, err)
+		}
+		return nil
+	}
+	// MS_RDONLY is ignored when a bind mount is created; it only takes
+	// effect on a remount
+	if err := syscall.Mount(m.Source, target, "", m.Flags&^syscall.MS_RDONLY, ""); err != nil {
+		return fmt.Errorf("bind %s on %s: %w", m.Source, m.Target, err)
+	}
+	if m.Flags&syscall.MS_RDONLY != 0 {
+		if err := remountReadOnly(target); err != nil {
+			return fmt.Errorf("make %s read-only: %w", m.Target, err)
+		}
+	}
+	return nil
+}
+
+// remountReadOnly makes the mount at target and every mount below it
+// read-only: a recursive bind brings the submounts of the source along,
+// and a remount only changes the one mount it names. The other per-mount
+// flags are kept, since a bind remount replaces them all.
+func remountReadOnly(target string) error {
+	b, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		mp, flags, ok := parseMountinfo(line)
+		if !ok || (mp != target && !strings.HasPrefix(mp, target+"/")) {
+			continue
+		}
+		if err := syscall.Mount("", mp, "", flags|syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY, ""); err != nil {
+			return fmt.Errorf("%s: %w", mp, err)
+		}
+	}
+	return nil
+}
+
+// mountinfoFlags are the per-mount options of /proc/self/mountinfo that a
+// remount has to pass again.
+var mountinfoFlags = map[string]uintptr{
+	"nosuid":      syscall.MS_NOSUID,
+	"nodev":       syscall.MS_NODEV,
+	"noexec":      syscall.MS_NOEXEC,
+	"noatime":     syscall.MS_NOATIME,
+	"nodiratime":  syscall.MS_NODIRATIME,
+	"relatime":    syscall.MS_RELATIME,
+	"strictatime": syscall.MS_STRICTATIME,
+}
+
+// parseMountinfo returns the mount point and per-mount flags of a line of
+// /proc/self/mountinfo.
+func parseMountinfo(line string) (string, uintptr, bool) {
+	f := strings.Fields(line)
+	if len(f) < 6 {
+		return "", 0, false
+	}
+	var flags uintptr
+	for _, o := range strings.Split(f[5], ",") {
+		flags |= mountinfoFlags[o]
+	}
+	return unescapeMountinfo(f[4]), flags, true
+}
+
+// unescapeMountinfo undoes the octal escapes, such as \040 for a space,
+// the kernel writes in mountinfo paths.
+func unescapeMountinfo(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// mkMountpoint creates the directory to mount on, or an empty file when a
+// single file is bind mounted.
+func mkMountpoint(m mountEntry, target string, isBind bool) error {
+	if isBind {
+		fi, err := os.Stat(m.Source)
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY, 0o644)
+			if err != nil {
+				return err
+			}
+			return f.Close()
+		}
+	}
+	return os.MkdirAll(target, 0o755)
+}
+
+// populateDev creates the standard device nodes and links in the
+// container's /dev. Where mknod is not permitted the host's node is bind
+// mounted instead.
+func populateDev(rootfs string) error {
+	dev := filepath.Join(rootfs, "dev")
+	for _, d := range devices {
+		p := filepath.Join(dev, d.name)
+		err := syscall.Mknod(p, syscall.S_IFCHR|0o666, int(mkdev(d.major, d.minor)))
+		if err == nil {
+			// mknod honours the umask
+			err = os.Chmod(p, 0o666)
+		} else if err == syscall.EPERM {
+			err = bindDevice(filepath.Join("/dev", d.name), p)
+		}
+		if err != nil {
+			return fmt.Errorf("create /dev/%s: %w", d.name, err)
+		}
+	}
+	for _, l := range devSymlinks {
+		if err := os.Symlink(l[0], filepath.Join(rootfs, l[1])); err != nil {
+			return fmt.Errorf("link %s: %w", l[1], err)
+		}
+	}
+	return nil
+}
+
+func bindDevice(host, target string) error {
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY, 0o666)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return syscall.Mount(host, target, "", syscall.MS_BIND, "")
+}
+
+func mkdev(major, minor uint32) uint64 {
+	return uint64(minor&0xff) | uint64(major&0xfff)<<8 | uint64(minor&^0xff)<<12 | uint64(major&^0xfff)<<32
+}
+
+// switchRoot makes rootfs, which must already be a mount point, the root of
+// the current mount namespace. It uses pivot_root so the host tree is
+// detached and cannot be reached again, and falls back to chroot where
+// pivot_root is not possible (e.g. when the host runs from an initramfs).
+func switchRoot(rootfs string) error {
+	if err := pivotRoot(rootfs); err != nil {
+		fmt.Fprintf(os.Stderr, "init: pivot_root: %v, falling back to chroot\n", err)
+		if err := syscall.Chroot(rootfs); err != nil {
+			return fmt.Errorf("chroot: %w", err)
+		}
+	}
+	return os.Chdir("/")
+}
+
+func pivotRoot(rootfs string) error {
+	if err := os.Chdir(rootfs); err != nil {
+		return err
+	}
+	// stack the old root on top of the new one instead of needing a
+	// directory for it inside the rootfs, which may be read-only
+	if err := syscall.PivotRoot(".", "."); err != nil {
+		return err
+	}
+	if err := syscall.Unmount(".", syscall.MNT_DETACH); err != nil {
+		return fmt.Errorf("detach old root: %w", err)
+	}
+	return nil
+}
@@ -3,133 +3,381 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
-	"path/filepath"
+	"os/signal"
 	"syscall"
 	"time"
 
 	"example.com/containeredu/internal/cgroups"
 	"example.com/containeredu/internal/id"
-	"example.com/containeredu/internal/overlay"
+	"example.com/containeredu/internal/images"
 	"example.com/containeredu/internal/paths"
 	netplug "example.com/containeredu/internal/plugins/net"
+	_ "example.com/containeredu/internal/plugins/net/bridge"
+	"example.com/containeredu/internal/plugins/storage"
+	"example.com/containeredu/internal/plugins/storage/vfs"
+	"example.com/containeredu/internal/pty"
 	"example.com/containeredu/internal/state"
+	"example.com/containeredu/internal/volumes"
 )
 
-func runContainer(image, command string, args []string, hostname, netPlugin, cpuMax, memMax string, pidsMax int) error {
+// runContainer creates and starts a container. In the foreground it waits
+// for it and returns its exit code; detached it returns 0 once the shim
+// has started it.
+func runContainer(opts runOptions) (int, error) {
 	if err := paths.EnsureDirs(); err != nil {
-		return err
+		return -1, err
+	}
+	if _, err := logDriver(opts.LogDriver); err != nil {
+		return -1, err
+	}
+	driver, err := storageDriver(opts.StorageDriver)
+	if err != nil {
+		return -1, err
+	}
+	// only a driver picked on the command line is used come what may
+	fallback := opts.StorageDriver == ""
+	for _, spec := range opts.Tmpfs {
+		if _, err := parseTmpfs(spec); err != nil {
+			return -1, err
+		}
+	}
+	var named []string
+	for _, spec := range opts.Volumes {
+		v, err := parseVolume(spec)
+		if err != nil {
+			return -1, err
+		}
+		if v.named() {
+			named = append(named, v.Source)
+		} else if _, err := os.Stat(v.Source); err != nil {
+			return -1, fmt.Errorf("bind source: %w", err)
+		}
 	}
 	idStr := id.New()
-	imgRoot := filepath.Join(paths.ImagesRoot(), image)
-	layersRoot := filepath.Join(imgRoot, "layers")
-	entries, err := os.ReadDir(layersRoot)
+	lowers, err := images.LayerDirs(opts.Image)
+	if err != nil {
+		return -1, fmt.Errorf("image %s not found: %w", opts.Image, err)
+	}
+	imageRun, err := images.LoadRunConfig(opts.Image)
+	if err != nil {
+		return -1, err
+	}
+	opts = applyImageConfig(opts, imageRun)
+	// undo the mount and any other leftovers if the container never starts
+	started := false
+	defer func() {
+		if !started {
+			_ = removeContainer(idStr, true)
+		}
+	}()
+	st := state.ContainerState{
+		ID:        idStr,
+		Image:     opts.Image,
+		Command:   opts.Command,
+		Args:      opts.Args,
+		CreatedAt: time.Now(),
+		Hostname:  opts.Hostname,
+		Status:    state.StatusCreated,
+	}
+	err = createRootfs(&st, driver, lowers)
+	if err != nil && fallback && driver.Name() != vfs.Name {
+		fmt.Fprintf(os.Stderr, "%v; falling back to the vfs storage driver\n", err)
+		_ = driver.Remove(idStr)
+		driver, _ = storageDriver(vfs.Name)
+		err = createRootfs(&st, driver, lowers)
+	}
+	if err != nil {
+		return -1, err
+	}
+	opts.StorageDriver = driver.Name()
+	if err := saveRunOptions(idStr, opts); err != nil {
+		return -1, err
+	}
+	for _, name := range named {
+		if _, err := volumes.Acquire(name, idStr); err != nil {
+			return -1, err
+		}
+	}
+	if opts.Detach {
+		if err := startShim(idStr); err != nil {
+			return -1, err
+		}
+		started = true
+		fmt.Println(idStr)
+		return 0, nil
+	}
+	clog, err := openContainerLog(idStr, opts.LogDriver, opts.LogOpts)
+	if err != nil {
+		return -1, err
+	}
+	cmd, detach, err := startAttached(&st, opts, os.Stdin, io.MultiWriter(os.Stdout, clog.stdout), io.MultiWriter(os.Stderr, clog.stderr))
+	if err != nil {
+		clog.Close()
+		return -1, err
+	}
+	started = true
+	stopProxy := proxySignals(cmd.Process)
+	waitErr := waitContainer(&st, cmd)
+	stopProxy()
+	detach()
+	clog.Close()
+	if opts.Remove {
+		if err := removeContainer(st.ID, true); err != nil {
+			fmt.Fprintf(os.Stderr, "rm %s: %v\n", st.ID, err)
+		}
+	}
+	if _, ok := waitErr.(*exec.ExitError); waitErr != nil && !ok {
+		return -1, waitErr
+	}
+	return st.ExitCode, nil
+}
+
+// createRootfs builds and mounts st's filesystem with driver and records
+// both in the state. layers are the image's layer directories as
+// images.LayerDirs returns them, top-most first, the order
+// storage.Driver.Create takes.
+func createRootfs(st *state.ContainerState, driver storage.Driver, layers []string) error {
+	st.StorageDriver = driver.Name()
+	// saved before the filesystem exists so rm knows which driver to ask
+	if err := state.Save(*st); err != nil {
+		return err
+	}
+	if err := driver.Create(st.ID, layers); err != nil {
+		return fmt.Errorf("%s: %w", driver.Name(), err)
+	}
+	mountDir, err := driver.Mount(st.ID)
+	if err != nil {
+		return err
+	}
+	st.MountDir = mountDir
+	return state.Save(*st)
+}
+
+// startAttached starts the container with the given stdio, or with a new pty
+// relayed to stdin and stdout when opts.TTY is set; stderr then goes to the
+// pty as well. Call detach once the container has exited.
+func startAttached(st *state.ContainerState, opts runOptions, stdin *os.File, stdout, stderr io.Writer) (cmd *exec.Cmd, detach func(), err error) {
+	if !opts.TTY {
+		var in io.Reader
+		if stdin != nil {
+			in = stdin
+		}
+		cmd, err := startContainer(st, opts, in, stdout, stderr)
+		return cmd, func() {}, err
+	}
+	master, slave, err := pty.Open()
 	if err != nil {
-		return fmt.Errorf("image %s not found: %w", image, err)
+		return nil, nil, fmt.Errorf("allocate pty: %w", err)
 	}
-	var lowers []string
-	for _, e := range entries {
-		if e.IsDir() {
-			lowers = append(lowers, filepath.Join(layersRoot, e.Name()))
+	detach = attachTTY(master, stdin, stdout)
+	cmd, err = startContainer(st, opts, slave, slave, slave)
+	// only the container may hold the slave, or the relay never sees EOF
+	slave.Close()
+	if err != nil {
+		detach()
+		return nil, nil, err
+	}
+	return cmd, detach, nil
+}
+
+// startContainer launches the namespaced init process for st and records it
+// as running. The caller owns the returned command and must wait on it.
+func startContainer(st *state.ContainerState, opts runOptions, stdin io.Reader, stdout, stderr io.Writer) (*exec.Cmd, error) {
+	initArgs := []string{"init", "--rootfs", st.MountDir, "--cmd", opts.Command, "--hostname", opts.Hostname}
+	if opts.TTY {
+		initArgs = append(initArgs, "--tty")
+	}
+	if opts.NoInit {
+		initArgs = append(initArgs, "--init=false")
+	}
+	if opts.WorkingDir != "" {
+		initArgs = append(initArgs, "--workdir", opts.WorkingDir)
+	}
+	if opts.User != "" {
+		initArgs = append(initArgs, "--user", opts.User)
+	}
+	for _, spec := range opts.Tmpfs {
+		initArgs = append(initArgs, "--tmpfs", spec)
+	}
+	for _, spec := range opts.Volumes {
+		v, err := parseVolume(spec)
+		if err != nil {
+			return nil, err
+		}
+		// init only deals in host paths
+		if v.named() {
+			vol, err := volumes.Get(v.Source)
+			if err != nil {
+				return nil, err
+			}
+			v.Source = vol.Mountpoint
+		}
+		// as JSON rather than -v syntax: a volume's mountpoint is under the
+		// data root, whose path may hold the ":" parseVolume splits on
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
 		}
+		initArgs = append(initArgs, "--volume", string(b))
 	}
-	containerRoot := filepath.Join(paths.ContainersRoot(), idStr)
-	upper := filepath.Join(containerRoot, "upper")
-	work := filepath.Join(containerRoot, "work")
-	mountDir := filepath.Join(containerRoot, "rootfs")
-	if err := overlay.Prepare(overlay.MountSpec{
-		LowerDirs: lowers,
-		UpperDir:  upper,
-		WorkDir:   work,
-		MountDir:  mountDir,
-	}); err != nil {
-		return fmt.Errorf("overlay mount: %w", err)
-	}
-	initArgs := []string{"init", "--rootfs", mountDir, "--cmd", command, "--hostname", hostname}
-	initArgs = append(initArgs, args...)
+	initArgs = append(initArgs, "--")
+	initArgs = append(initArgs, opts.Args...)
 	cmd := exec.Command("/proc/self/exe", initArgs...)
 	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Cloneflags: syscall.CLONE_NEWUTS | syscall.CLONE_NEWPID | syscall.CLONE_NEWNET | syscall.CLONE_NEWNS,
+		Cloneflags: syscall.CLONE_NEWUTS | syscall.CLONE_NEWPID | syscall.CLONE_NEWNET | syscall.CLONE_NEWNS | syscall.CLONE_NEWIPC,
+		// keep the container out of the CLI's process group so terminal
+		// signals reach it only through proxySignals
+		Setsid: true,
 	}
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	// init hands its own environment to the workload; unlike its
+	// arguments, /proc/<pid>/environ is readable only by the owner
+	cmd.Env = append([]string{}, opts.Env...)
+	if term := os.Getenv("TERM"); opts.TTY && term != "" {
+		cmd.Env = withDefaults(cmd.Env, "TERM="+term)
+	}
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 	if err := cmd.Start(); err != nil {
-		return err
+		return nil, err
 	}
-	_ = cgroups.ApplyV2(idStr, cmd.Process.Pid, cgroups.Limits{
-		CPUMax:  cpuMax,
-		MemMax:  memMax,
-		PidsMax: pidsMax,
+	_ = cgroups.ApplyV2(st.ID, cmd.Process.Pid, cgroups.Limits{
+		CPUMax:  opts.CPUMax,
+		MemMax:  opts.MemMax,
+		PidsMax: opts.PidsMax,
 	})
-	var ip string
-	if netPlugin != "" {
-		if p := netplug.Get(netPlugin); p != nil {
-			ip, _ = p.Setup(idStr, cmd.Process.Pid)
+	if opts.Net != "" {
+		st.Net = opts.Net
+		if p := netplug.Get(opts.Net); p != nil {
+			st.IP, _ = p.Setup(st.ID, cmd.Process.Pid)
 		}
 	}
-	st := state.ContainerState{
-		ID:        idStr,
-		Image:     image,
-		Pid:       cmd.Process.Pid,
-		Command:   command,
-		Args:      args,
-		CreatedAt: time.Now(),
-		Hostname:  hostname,
-		IP:        ip,
-		Status:    "running",
-		MountDir:  mountDir,
+	st.Pid = cmd.Process.Pid
+	st.PidStartTime, _ = state.ProcessStartTime(st.Pid)
+	st.Status = state.StatusRunning
+	st.StartedAt = time.Now()
+	_ = state.Save(*st)
+	return cmd, nil
+}
+
+// waitContainer waits for the init process and writes the exit code and
+// exit time back into the state record. The record is read again first:
+// while the container ran others, such as stop, may have written to it.
+func waitContainer(st *state.ContainerState, cmd *exec.Cmd) error {
+	waitErr := cmd.Wait()
+	cur, err := state.Load(st.ID)
+	if err == nil {
+		*st = cur
+	}
+	st.Status = state.StatusExited
+	st.ExitCode = exitCode(cmd.ProcessState)
+	st.FinishedAt = time.Now()
+	// a container removed meanwhile must not come back
+	if !os.IsNotExist(err) {
+		_ = state.Save(*st)
 	}
-	_ = state.Save(st)
-	return cmd.Wait()
+	return waitErr
 }
 
-func childInit() error {
-	var rootfs string
-	var cmdPath string
-	var hostname string
-	rest := []string{}
-	for i := 0; i < len(os.Args); i++ {
-		switch os.Args[i] {
-		case "--rootfs":
-			i++
-			if i < len(os.Args) {
-				rootfs = os.Args[i]
-			}
-		case "--cmd":
-			i++
-			if i < len(os.Args) {
-				cmdPath = os.Args[i]
-			}
-		case "--hostname":
-			i++
-			if i < len(os.Args) {
-				hostname = os.Args[i]
-			}
-		default:
-			rest = append(rest, os.Args[i])
+func exitCode(ps *os.ProcessState) int {
+	if ps == nil {
+		return -1
+	}
+	if ws, ok := ps.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return ps.ExitCode()
+}
+
+// proxySignals relays the signals a user typically sends to the CLI on to the
+// container's init until the returned function is called.
+func proxySignals(p *os.Process) func() {
+	sigs := make(chan os.Signal, 8)
+	signal.Notify(sigs, syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range sigs {
+			_ = p.Signal(sig)
 		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(sigs)
+	}
+}
+
+// startShim re-executes cede as a session leader that supervises the
+// container, so it keeps running after the CLI returns. The shim reports
+// startup success by closing fd 3, or failure by writing the error to it.
+func startShim(containerID string) error {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	cmd := exec.Command("/proc/self/exe", "shim", "--id", containerID, "--ready-fd", "3")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	cmd.ExtraFiles = []*os.File{w}
+	if err := cmd.Start(); err != nil {
+		w.Close()
+		return fmt.Errorf("start shim: %w", err)
 	}
-	if rootfs == "" || cmdPath == "" {
-		return fmt.Errorf("init: missing --rootfs or --cmd")
+	w.Close()
+	msg, _ := io.ReadAll(r)
+	_ = cmd.Process.Release()
+	if len(msg) > 0 {
+		return fmt.Errorf("shim: %s", msg)
 	}
-	if err := syscall.Chroot(rootfs); err != nil {
-		return fmt.Errorf("chroot: %w", err)
+	return nil
+}
+
+func runShim(containerID string, readyFD int) error {
+	var ready *os.File
+	if readyFD > 0 {
+		// inherited fds are not close-on-exec; keep it out of the container
+		syscall.CloseOnExec(readyFD)
+		ready = os.NewFile(uintptr(readyFD), "ready")
 	}
-	if err := os.Chdir("/"); err != nil {
+	fail := func(err error) error {
+		if ready != nil {
+			fmt.Fprint(ready, err.Error())
+			ready.Close()
+		}
 		return err
 	}
-	if err := syscall.Mount("proc", "/proc", "proc", 0, ""); err != nil {
-		return fmt.Errorf("mount proc: %w", err)
+	st, err := state.Load(containerID)
+	if err != nil {
+		return fail(err)
+	}
+	opts, err := loadRunOptions(containerID)
+	if err != nil {
+		return fail(err)
+	}
+	clog, err := openContainerLog(containerID, opts.LogDriver, opts.LogOpts)
+	if err != nil {
+		return fail(err)
+	}
+	cmd, detach, err := startAttached(&st, opts, nil, clog.stdout, clog.stderr)
+	if err != nil {
+		clog.Close()
+		st.Status = state.StatusExited
+		st.ExitCode = -1
+		st.FinishedAt = time.Now()
+		_ = state.Save(st)
+		return fail(err)
+	}
+	if ready != nil {
+		ready.Close()
 	}
-	if hostname != "" {
-		_ = syscall.Sethostname([]byte(hostname))
+	waitErr := waitContainer(&st, cmd)
+	detach()
+	clog.Close()
+	if opts.Remove {
+		_ = removeContainer(st.ID, true)
 	}
-	cmd := exec.Command(cmdPath, rest...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return waitErr
 }
@@ -4,10 +4,10 @@ package main
 
 import "fmt"
 
-func runContainer(image, command string, args []string, hostname, netPlugin, cpuMax, memMax string, pidsMax int) error {
-	return fmt.Errorf("run is only supported on linux")
+func runContainer(opts runOptions) (int, error) {
+	return -1, fmt.Errorf("run is only supported on linux")
 }
 
-func childInit() error {
-	return fmt.Errorf("init is only supported on linux")
+func runShim(containerID string, readyFD int) error {
+	return fmt.Errorf("shim is only supported on linux")
 }
@@ -6,6 +6,8 @@ import (
 	"runtime"
 	"strings"
 	"testing"
+
+	"example.com/containeredu/internal/images"
 )
 
 func TestSplitLines(t *testing.T) {
@@ -34,9 +36,9 @@ func TestBuildImageScratch(t *testing.T) {
 		t.Fatalf("build error: %v", err)
 	}
 	home, _ := os.UserHomeDir()
-	meta := filepath.Join(home, ".local", "share", "cede", "images", tag, "metadata.json")
+	meta := filepath.Join(home, ".local", "share", "cede", "images", tag, "manifest.json")
 	if _, err := os.Stat(meta); err != nil {
-		t.Fatalf("metadata missing: %v", err)
+		t.Fatalf("manifest missing: %v", err)
 	}
 }
 
@@ -55,8 +57,11 @@ func TestBuildImageAddFile(t *testing.T) {
 	if err := buildImage(df, tag); err != nil {
 		t.Fatalf("build error: %v", err)
 	}
-	home, _ := os.UserHomeDir()
-	target := filepath.Join(home, ".local", "share", "cede", "images", tag, "layers", "00", "etc", "file.txt")
+	dirs, err := images.LayerDirs(tag)
+	if err != nil || len(dirs) != 1 {
+		t.Fatalf("layers = %v, %v", dirs, err)
+	}
+	target := filepath.Join(dirs[0], "etc", "file.txt")
 	b, err := os.ReadFile(target)
 	if err != nil {
 		t.Fatalf("file not copied: %v", err)
@@ -146,7 +151,7 @@ func TestListContainersOutput(t *testing.T) {
 	r, w, _ := os.Pipe()
 	old := os.Stdout
 	os.Stdout = w
-	if err := listContainers(); err != nil {
+	if err := listContainers(false); err != nil {
 		t.Fatalf("list: %v", err)
 	}
 	w.Close()
@@ -208,7 +213,7 @@ func TestChildInitMissingArgs(t *testing.T) {
 	os.Args = []string{"cede", "init"}
 	
 	// 调用childInit函数
-	err := childInit()
+	_, err := childInit()
 	
 	// 验证返回错误
 	if err == nil {
@@ -229,7 +234,7 @@ func TestChildInitInvalidRootfs(t *testing.T) {
 	os.Args = []string{"cede", "init", "--rootfs", "/nonexistent/path", "--cmd", "/bin/sh"}
 	
 	// 调用childInit函数
-	err := childInit()
+	_, err := childInit()
 	
 	// 验证返回错误（在Windows上应该是错误，因为chroot不存在）
 	if err == nil {
@@ -249,7 +254,7 @@ func TestRunContainerImageNotFound(t *testing.T) {
 	os.Setenv("HOME", tmp)
 	
 	// 测试运行一个不存在的镜像
-	err := runContainer("nonexistent-image", "/bin/sh", []string{}, "test-hostname", "bridge0", "", "", 0)
+	_, err := runContainer(runOptions{Image: "nonexistent-image", Command: "/bin/sh", Args: []string{}, Hostname: "test-hostname", Net: "bridge0"})
 	
 	// 验证返回错误
 	if err == nil {
@@ -290,7 +295,7 @@ func TestRunContainerInvalidImageStructure(t *testing.T) {
 	}
 	
 	// 测试运行一个结构无效的镜像
-	err := runContainer(imageName, "/bin/sh", []string{}, "test-hostname", "bridge0", "", "", 0)
+	_, err := runContainer(runOptions{Image: imageName, Command: "/bin/sh", Args: []string{}, Hostname: "test-hostname", Net: "bridge0"})
 	
 	// 验证返回错误
 	if err == nil {
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+
+	"example.com/containeredu/internal/plugins/storage"
+	_ "example.com/containeredu/internal/plugins/storage/overlay"
+	_ "example.com/containeredu/internal/plugins/storage/vfs"
+	"example.com/containeredu/internal/state"
+)
+
+// storageDriver resolves a --storage-driver value; empty means the data
+// root's configured default.
+func storageDriver(name string) (storage.Driver, error) {
+	if name == "" {
+		name = storage.ConfiguredDriver()
+	}
+	d := storage.Get(name)
+	if d == nil {
+		return nil, fmt.Errorf("unknown storage driver: %s", name)
+	}
+	return d, nil
+}
+
+// containerStorage returns the driver that built st's filesystem.
+func containerStorage(st state.ContainerState) (storage.Driver, error) {
+	// records without a driver name predate storage drivers
+	if st.StorageDriver == "" {
+		return storageDriver(storage.DefaultDriver)
+	}
+	return storageDriver(st.StorageDriver)
+}
+
+// containerSize reports how much a container has written, e.g. "12.3kB".
+func containerSize(st state.ContainerState) string {
+	d, err := containerStorage(st)
+	if err != nil {
+		return "-"
+	}
+	n, err := d.Size(st.ID)
+	if err != nil {
+		return "-"
+	}
+	return humanSize(n)
+}
+
+func humanSize(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	f := float64(n)
+	for _, suffix := range []string{"kB", "MB", "GB"} {
+		f /= unit
+		if f < unit {
+			return fmt.Sprintf("%.1f%s", f, suffix)
+		}
+	}
+	return fmt.Sprintf("%.1fTB", f/unit)
+}
@@ -0,0 +1,52 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"example.com/containeredu/internal/images"
+	"example.com/containeredu/internal/plugins/storage/vfs"
+	"example.com/containeredu/internal/state"
+)
+
+func TestCreateRootfsStacksTopLayerFirst(t *testing.T) {
+	os.Setenv("HOME", t.TempDir())
+	var layers []string
+	for _, content := range []string{"top", "base"} {
+		dir, err := images.NewLayerDir()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "which"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		digest, err := images.CommitLayer(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		layers = append(layers, digest)
+	}
+	if err := images.SaveManifest(images.Manifest{Name: "stacked", Layers: layers, LayerOrder: images.OrderTopFirst}); err != nil {
+		t.Fatal(err)
+	}
+	// what run hands the driver
+	lowers, err := images.LayerDirs("stacked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := storageDriver(vfs.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := state.ContainerState{ID: "8d3f2a61-0b7c-4e59-a1d4-6c2e9f7b3a05"}
+	if err := createRootfs(&st, d, lowers); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Remove(st.ID)
+	if b, err := os.ReadFile(filepath.Join(st.MountDir, "which")); err != nil || string(b) != "top" {
+		t.Fatalf("rootfs has %q, %v; want the top layer's file", b, err)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestStorageDriverResolution(t *testing.T) {
+	os.Setenv("HOME", t.TempDir())
+	d, err := storageDriver("")
+	if err != nil || d.Name() != "overlay" {
+		t.Fatalf("default driver = %v, %v", d, err)
+	}
+	if _, err := storageDriver("nope"); err == nil {
+		t.Fatalf("unknown driver should be rejected")
+	}
+}
+
+func TestHumanSize(t *testing.T) {
+	cases := map[int64]string{0: "0B", 999: "999B", 1500: "1.5kB", 2_000_000: "2.0MB"}
+	for n, want := range cases {
+		if got := humanSize(n); got != want {
+			t.Fatalf("humanSize(%d) = %s, want %s", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+//go:build linux
+
+package main
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"example.com/containeredu/internal/pty"
+)
+
+// attachTTY relays a container's pty master to stdout and, unless stdin
+// is nil, stdin to the master. If stdin is a terminal it is switched to
+// raw mode and its window size is mirrored onto the pty, now and on every
+// SIGWINCH. The returned function waits until the container side of the
+// pty has been closed and then restores the host terminal.
+func attachTTY(master, stdin *os.File, stdout io.Writer) func() {
+	restore := func() {}
+	stopResize := func() {}
+	if stdin != nil && pty.IsTerminal(stdin.Fd()) {
+		if old, err := pty.MakeRaw(stdin.Fd()); err == nil {
+			restore = func() { _ = pty.Restore(stdin.Fd(), old) }
+		}
+		resize := func() {
+			if ws, err := pty.GetSize(stdin.Fd()); err == nil {
+				_ = pty.SetSize(master.Fd(), ws)
+			}
+		}
+		resize()
+		winch := make(chan os.Signal, 1)
+		signal.Notify(winch, syscall.SIGWINCH)
+		go func() {
+			for range winch {
+				resize()
+			}
+		}()
+		stopResize = func() {
+			signal.Stop(winch)
+			close(winch)
+		}
+	}
+	if stdin != nil {
+		go func() { _, _ = io.Copy(master, stdin) }()
+	}
+	done := make(chan struct{})
+	go func() {
+		// ends with EIO once every slave fd is closed
+		_, _ = io.Copy(stdout, master)
+		close(done)
+	}()
+	return func() {
+		<-done
+		stopResize()
+		restore()
+		master.Close()
+	}
+}
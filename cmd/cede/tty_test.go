@@ -0,0 +1,27 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"example.com/containeredu/internal/pty"
+)
+
+func TestAttachTTYRelaysUntilHangup(t *testing.T) {
+	master, slave, err := pty.Open()
+	if err != nil {
+		t.Skipf("no pty support: %v", err)
+	}
+	var out bytes.Buffer
+	detach := attachTTY(master, nil, &out)
+	if _, err := slave.Write([]byte("one\ntwo\n")); err != nil {
+		t.Fatal(err)
+	}
+	slave.Close()
+	detach()
+	if got := out.String(); got != "one\r\ntwo\r\n" {
+		t.Fatalf("relayed %q", got)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// execUser is who a container process runs as.
+type execUser struct {
+	Uid, Gid uint32
+	// Groups are the supplementary groups.
+	Groups []uint32
+	Home   string
+}
+
+// resolveUser looks up spec, a user with an optional group, each a name or
+// a numeric ID ("app", "1000", "app:staff", "1000:50"), in the passwd and
+// group files of the filesystem at root. Without a group the user's own
+// group and the groups listing it as a member are used. Numeric IDs need
+// no entry; an empty spec is root.
+func resolveUser(root, spec string) (execUser, error) {
+	u := execUser{Home: "/"}
+	userSpec, groupSpec, hasGroup := strings.Cut(spec, ":")
+	if userSpec == "" {
+		userSpec = "0"
+	}
+	passwd, err := readColonFile(filepath.Join(root, "etc", "passwd"))
+	if err != nil {
+		return u, err
+	}
+	name := ""
+	found := false
+	uid, numeric := parseID(userSpec)
+	for _, f := range passwd {
+		if len(f) < 6 {
+			continue
+		}
+		id, ok := parseID(f[2])
+		if !ok || f[0] != userSpec && (!numeric || id != uid) {
+			continue
+		}
+		gid, _ := parseID(f[3])
+		name, u.Uid, u.Gid, u.Home = f[0], id, gid, f[5]
+		found = true
+		break
+	}
+	if !found {
+		if !numeric {
+			return u, fmt.Errorf("user %s: no matching entry in /etc/passwd", userSpec)
+		}
+		u.Uid = uid
+	}
+	group, err := readColonFile(filepath.Join(root, "etc", "group"))
+	if err != nil {
+		return u, err
+	}
+	if hasGroup {
+		gid, ok := parseID(groupSpec)
+		for _, f := range group {
+			if len(f) >= 3 && f[0] == groupSpec {
+				gid, ok = parseID(f[2])
+				break
+			}
+		}
+		if !ok {
+			return u, fmt.Errorf("group %s: no matching entry in /etc/group", groupSpec)
+		}
+		u.Gid = gid
+		return u, nil
+	}
+	if name == "" {
+		return u, nil
+	}
+	for _, f := range group {
+		if len(f) < 4 {
+			continue
+		}
+		for _, m := range strings.Split(f[3], ",") {
+			if gid, ok := parseID(f[2]); ok && m == name && gid != u.Gid {
+				u.Groups = append(u.Groups, gid)
+			}
+		}
+	}
+	return u, nil
+}
+
+func parseID(s string) (uint32, bool) {
+	n, err := strconv.ParseUint(s, 10, 32)
+	return uint32(n), err == nil
+}
+
+// readColonFile splits the lines of a passwd-style file into fields. A
+// missing file has no entries.
+func readColonFile(p string) ([][]string, error) {
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out [][]string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		out = append(out, strings.Split(line, ":"))
+	}
+	return out, s.Err()
+}
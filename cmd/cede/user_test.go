@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolveUser(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "etc"), 0o755)
+	os.WriteFile(filepath.Join(root, "etc", "passwd"), []byte("root:x:0:0:root:/root:/bin/sh\n# comment\napp:x:1000:1000::/home/app:/bin/sh\n"), 0o644)
+	os.WriteFile(filepath.Join(root, "etc", "group"), []byte("root:x:0:\napp:x:1000:\nstaff:x:50:app,other\nwheel:x:10:root\n"), 0o644)
+	cases := []struct {
+		spec string
+		want execUser
+	}{
+		{"", execUser{Uid: 0, Gid: 0, Groups: []uint32{10}, Home: "/root"}},
+		{"app", execUser{Uid: 1000, Gid: 1000, Groups: []uint32{50}, Home: "/home/app"}},
+		{"1000", execUser{Uid: 1000, Gid: 1000, Groups: []uint32{50}, Home: "/home/app"}},
+		{"app:staff", execUser{Uid: 1000, Gid: 50, Home: "/home/app"}},
+		{"app:7", execUser{Uid: 1000, Gid: 7, Home: "/home/app"}},
+		{"4242", execUser{Uid: 4242, Home: "/"}},
+		{"4242:4242", execUser{Uid: 4242, Gid: 4242, Home: "/"}},
+	}
+	for _, c := range cases {
+		got, err := resolveUser(root, c.spec)
+		if err != nil {
+			t.Errorf("%q: %v", c.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q = %+v, want %+v", c.spec, got, c.want)
+		}
+	}
+	for _, bad := range []string{"nobody", "app:nogroup"} {
+		if _, err := resolveUser(root, bad); err == nil {
+			t.Errorf("%q should not resolve", bad)
+		}
+	}
+	// an image without passwd still runs numeric users
+	if u, err := resolveUser(t.TempDir(), "1:2"); err != nil || u.Uid != 1 || u.Gid != 2 {
+		t.Fatalf("no passwd: %+v, %v", u, err)
+	}
+}
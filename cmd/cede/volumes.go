@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"example.com/containeredu/internal/id"
+	"example.com/containeredu/internal/volumes"
+)
+
+// volumeSpec is a parsed -v value. Source is an absolute host path for a
+// bind mount, or otherwise the name of a volume.
+type volumeSpec struct {
+	Source   string
+	Target   string
+	ReadOnly bool
+}
+
+func (v volumeSpec) named() bool {
+	return !filepath.IsAbs(v.Source)
+}
+
+func (v volumeSpec) String() string {
+	s := v.Source + ":" + v.Target
+	if v.ReadOnly {
+		s += ":ro"
+	}
+	return s
+}
+
+// parseVolume parses host:container[:ro|rw] or name:container[:ro|rw].
+// Relative host paths must start with "." and are made absolute.
+func parseVolume(spec string) (volumeSpec, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+		return volumeSpec{}, fmt.Errorf("volume %q: expected host:container[:ro]", spec)
+	}
+	v := volumeSpec{Source: parts[0], Target: parts[1]}
+	if len(parts) == 3 {
+		switch parts[2] {
+		case "ro":
+			v.ReadOnly = true
+		case "rw":
+		default:
+			return volumeSpec{}, fmt.Errorf("volume %q: unknown mode %q", spec, parts[2])
+		}
+	}
+	if !filepath.IsAbs(v.Target) {
+		return volumeSpec{}, fmt.Errorf("volume %q: container path must be absolute", spec)
+	}
+	v.Target = filepath.Clean(v.Target)
+	switch {
+	case filepath.IsAbs(v.Source):
+		v.Source = filepath.Clean(v.Source)
+	case strings.HasPrefix(v.Source, "."):
+		abs, err := filepath.Abs(v.Source)
+		if err != nil {
+			return volumeSpec{}, err
+		}
+		v.Source = abs
+	case !volumes.ValidName(v.Source):
+		return volumeSpec{}, fmt.Errorf("volume %q: invalid volume name %q", spec, v.Source)
+	}
+	return v, nil
+}
+
+func volumeCreate(name string) error {
+	if name == "" {
+		name = strings.ReplaceAll(id.New(), "-", "")
+	}
+	v, err := volumes.Create(name)
+	if err != nil {
+		return err
+	}
+	fmt.Println(v.Name)
+	return nil
+}
+
+func volumeList() error {
+	vols, err := volumes.List()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("NAME\tCONTAINERS\tMOUNTPOINT\n")
+	for _, v := range vols {
+		fmt.Printf("%s\t%d\t%s\n", v.Name, len(v.Containers), v.Mountpoint)
+	}
+	return nil
+}
+
+func volumeInspect(names []string) error {
+	var out []volumes.Volume
+	for _, n := range names {
+		v, err := volumes.Get(n)
+		if err != nil {
+			return err
+		}
+		out = append(out, v)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
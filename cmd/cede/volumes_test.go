@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseVolume(t *testing.T) {
+	v, err := parseVolume("/srv/data:/data:ro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.named() || v.Source != "/srv/data" || v.Target != "/data" || !v.ReadOnly {
+		t.Fatalf("bad bind spec: %+v", v)
+	}
+	if v.String() != "/srv/data:/data:ro" {
+		t.Fatalf("String() = %s", v.String())
+	}
+	v, err = parseVolume("cache:/var/cache/:rw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.named() || v.Source != "cache" || v.Target != "/var/cache" || v.ReadOnly {
+		t.Fatalf("bad named spec: %+v", v)
+	}
+	v, err = parseVolume("./rel:/x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	if v.Source != filepath.Join(wd, "rel") {
+		t.Fatalf("relative source not made absolute: %s", v.Source)
+	}
+	for _, bad := range []string{"/only", "/a:rel", "/a:/b:rx", ":/b", "a/b:/c", "/a:/b:ro:x"} {
+		if _, err := parseVolume(bad); err == nil {
+			t.Fatalf("%q should be rejected", bad)
+		}
+	}
+}
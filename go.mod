@@ -2,4 +2,7 @@ module example.com/containeredu
 
 go 1.22
 
-require github.com/google/uuid v1.6.0
+require (
+	github.com/google/uuid v1.6.0
+	github.com/klauspost/compress v1.18.0
+)
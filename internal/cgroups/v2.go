@@ -47,3 +47,25 @@ func ApplyV2(containerID string, pid int, lim Limits) error {
 	}
 	return nil
 }
+
+// Open opens the container's cgroup directory, for starting a process
+// straight into it with SysProcAttr.CgroupFD.
+func Open(containerID string) (*os.File, error) {
+	f, err := os.Open(filepath.Join(rootPath(), "cede", containerID))
+	if err != nil {
+		return nil, fmt.Errorf("open cgroup: %w", err)
+	}
+	return f, nil
+}
+
+// Remove deletes the container's cgroup. The group must have no live
+// processes left; a missing group is not an error.
+func Remove(containerID string) error {
+	root := rootPath()
+	group := filepath.Join(root, "cede", containerID)
+	err := os.Remove(group)
+	if err == nil || os.IsNotExist(err) {
+		return nil
+	}
+	return fmt.Errorf("remove cgroup: %w", err)
+}
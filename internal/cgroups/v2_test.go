@@ -117,3 +117,36 @@ func TestApplyV2PartialLimits(t *testing.T) {
 		t.Logf("ApplyV2 error (expected in some environments): %v", err)
 	}
 }
+
+func TestRemoveIsIdempotent(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("CEDE_CGROUP_ROOT", tmp)
+	group := filepath.Join(tmp, "cede", "gone")
+	if err := os.MkdirAll(group, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := Remove("gone"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(group); !os.IsNotExist(err) {
+		t.Fatalf("cgroup dir still present: %v", err)
+	}
+	if err := Remove("gone"); err != nil {
+		t.Fatalf("second remove: %v", err)
+	}
+}
+
+func TestRemoveWithControlFiles(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("CEDE_CGROUP_ROOT", tmp)
+	if err := ApplyV2("busy", os.Getpid(), Limits{PidsMax: 4}); err != nil {
+		t.Fatal(err)
+	}
+	// only rmdir is safe on a cgroup; a group that will not go is an error
+	if err := Remove("busy"); err == nil {
+		t.Fatalf("expected error removing a non-empty group")
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "cede", "busy", "pids.max")); err != nil {
+		t.Fatalf("group contents removed: %v", err)
+	}
+}
@@ -1,9 +1,18 @@
 package id
 
 import (
+	"regexp"
+
 	"github.com/google/uuid"
 )
 
+var format = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
 func New() string {
 	return uuid.NewString()
 }
+
+// Valid reports whether s has the form of an ID made by New.
+func Valid(s string) bool {
+	return format.MatchString(s)
+}
@@ -8,3 +8,14 @@ func TestNew(t *testing.T) {
 		t.Fatalf("empty uuid")
 	}
 }
+
+func TestValid(t *testing.T) {
+	if s := New(); !Valid(s) {
+		t.Fatalf("New() = %q is not valid", s)
+	}
+	for _, bad := range []string{"", "..", "../images", "abc", "0f3e1c2a-1b2c-4d5e-8f90-1234567890ab/x", "0F3E1C2A-1B2C-4D5E-8F90-1234567890AB"} {
+		if Valid(bad) {
+			t.Errorf("Valid(%q) = true", bad)
+		}
+	}
+}
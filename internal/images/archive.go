@@ -0,0 +1,272 @@
+package images
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+
+	"example.com/containeredu/internal/paths"
+)
+
+// source is where an import reads the files of an archive or layout from,
+// by their slash-separated paths in it.
+type source interface {
+	open(name string) (io.ReadCloser, error)
+}
+
+// dirSource is an image layout directory.
+type dirSource string
+
+func (d dirSource) open(name string) (io.ReadCloser, error) {
+	p, err := paths.SecureJoin(string(d), name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+// readFile reads the small file name, such as a manifest or config, from
+// src.
+func readFile(src source, name string) ([]byte, error) {
+	r, err := src.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	b, err := io.ReadAll(io.LimitReader(r, maxDocumentSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxDocumentSize {
+		return nil, fmt.Errorf("%s: %w: larger than %d bytes", name, ErrLimit, maxDocumentSize)
+	}
+	return b, nil
+}
+
+func exists(src source, name string) bool {
+	r, err := src.open(name)
+	if err != nil {
+		return false
+	}
+	r.Close()
+	return true
+}
+
+// maxBuffered bounds how much of an archive is kept in memory while it is
+// read; larger files are spooled to disk.
+const maxBuffered = 64 << 20
+
+// archiveSource holds the files of an archive read so far: small ones in
+// memory, the rest spooled to temporary files in the staging directory.
+type archiveSource struct {
+	files    map[string][]byte
+	spooled  map[string]string
+	links    map[string]string
+	buffered int64
+}
+
+func newArchiveSource() *archiveSource {
+	return &archiveSource{
+		files:   map[string][]byte{},
+		spooled: map[string]string{},
+		links:   map[string]string{},
+	}
+}
+
+// add keeps the file name read from r.
+func (a *archiveSource) add(name string, r io.Reader, size int64) error {
+	a.forget(name)
+	if size <= maxDocumentSize && a.buffered+size <= maxBuffered {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		a.files[name] = b
+		a.buffered += int64(len(b))
+		return nil
+	}
+	if err := os.MkdirAll(stagingDir(), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(stagingDir(), "blob-")
+	if err != nil {
+		return err
+	}
+	a.spooled[name] = f.Name()
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// link records name as a link to target, both archive paths.
+func (a *archiveSource) link(name, target string) {
+	a.forget(name)
+	a.links[name] = target
+}
+
+func (a *archiveSource) forget(name string) {
+	if p, ok := a.spooled[name]; ok {
+		os.Remove(p)
+		delete(a.spooled, name)
+	}
+	a.buffered -= int64(len(a.files[name]))
+	delete(a.files, name)
+	delete(a.links, name)
+}
+
+// resolve follows the links from name to the file it stands for.
+func (a *archiveSource) resolve(name string) string {
+	for i := 0; i < 16; i++ {
+		target, ok := a.links[name]
+		if !ok {
+			break
+		}
+		name = target
+	}
+	return name
+}
+
+func (a *archiveSource) has(name string) bool {
+	name = a.resolve(name)
+	_, ok := a.files[name]
+	_, spooled := a.spooled[name]
+	return ok || spooled
+}
+
+func (a *archiveSource) open(name string) (io.ReadCloser, error) {
+	clean, err := entryName(name)
+	if err != nil {
+		return nil, err
+	}
+	clean = a.resolve(clean)
+	if b, ok := a.files[clean]; ok {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+	if p, ok := a.spooled[clean]; ok {
+		return os.Open(p)
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// close removes the spooled files.
+func (a *archiveSource) close() {
+	for _, p := range a.spooled {
+		os.Remove(p)
+	}
+}
+
+// importArchive imports the images of the tarball read from r in a single
+// pass. Everything is kept until a docker save manifest.json and the
+// configs it names have been read; from then on the layers still to come
+// are extracted straight out of the archive and anything else is skipped.
+// What was read before is imported from memory or the spooled files once
+// the archive ends, planned by plan if there was no manifest.json.
+func importArchive(r io.Reader, name string, plan func(source, string) ([]imageSpec, error)) ([]Imported, error) {
+	a := newArchiveSource()
+	defer a.close()
+	var specs []imageSpec
+	// pending maps archive paths still to come to the layers they hold,
+	// once the archive has been planned
+	var pending map[string]layerFile
+	stored := map[string]bool{}
+	limits := DefaultLimits
+	var entries int
+	var total int64
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if entries++; entries > limits.MaxEntries {
+			return nil, fmt.Errorf("%w: more than %d entries", ErrLimit, limits.MaxEntries)
+		}
+		if hdr.Size > limits.MaxFileSize {
+			return nil, fmt.Errorf("%w: %s is %d bytes", ErrLimit, hdr.Name, hdr.Size)
+		}
+		if total += hdr.Size; total > limits.MaxTotalSize {
+			return nil, fmt.Errorf("%w: more than %d bytes", ErrLimit, limits.MaxTotalSize)
+		}
+		p, err := entryName(hdr.Name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+		case tar.TypeSymlink, tar.TypeLink:
+			target := hdr.Linkname
+			if hdr.Typeflag == tar.TypeSymlink && !path.IsAbs(target) {
+				target = path.Join(path.Dir(p), target)
+			}
+			if target, err = entryName(target); err != nil {
+				return nil, fmt.Errorf("%s: %w", hdr.Name, err)
+			}
+			a.link(p, target)
+			if l, ok := pending[p]; ok {
+				delete(pending, p)
+				if !a.has(target) {
+					pending[a.resolve(target)] = l
+				}
+			}
+			continue
+		default:
+			continue
+		}
+		if pending != nil {
+			l, ok := pending[p]
+			if !ok {
+				continue
+			}
+			delete(pending, p)
+			fresh, err := importLayer(tr, l)
+			if err != nil {
+				return nil, fmt.Errorf("extract layer %s: %w", p, err)
+			}
+			stored[l.DiffID] = fresh
+			continue
+		}
+		if err := a.add(p, tr, hdr.Size); err != nil {
+			return nil, err
+		}
+		if specs != nil || !a.has("manifest.json") {
+			continue
+		}
+		specs, err = planDockerSave(a, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			// a config is still to come
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		pending = map[string]layerFile{}
+		for _, spec := range specs {
+			for _, l := range spec.layers {
+				if !HasLayer(l.DiffID) && !a.has(l.Path) {
+					lp, err := entryName(l.Path)
+					if err != nil {
+						return nil, err
+					}
+					pending[a.resolve(lp)] = l
+				}
+			}
+		}
+	}
+	if specs == nil {
+		var err error
+		if specs, err = plan(a, name); err != nil {
+			return nil, err
+		}
+	}
+	return storeImages(a, specs, stored)
+}
@@ -0,0 +1,194 @@
+package images
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"example.com/containeredu/internal/paths"
+)
+
+// saveArchive returns a docker save archive of image img:1 made of layers
+// and of img:2, whose only layer is a symlink to the first one of img:1,
+// as docker writes layers shared between images. manifest.json and the
+// configs come first or last.
+func saveArchive(t *testing.T, metaFirst bool, layers ...[]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	var names []string
+	for i := range layers {
+		names = append(names, filepath.ToSlash(filepath.Join("l"+string(rune('0'+i)), "layer.tar")))
+	}
+	meta := func() {
+		addFileToTar(t, tw, "img1.json", configFor(layers...))
+		addFileToTar(t, tw, "img2.json", configFor(layers[0]))
+		mb, _ := json.Marshal([]ManifestEntry{
+			{Config: "img1.json", RepoTags: []string{"img:1"}, Layers: names},
+			{Config: "img2.json", RepoTags: []string{"img:2"}, Layers: []string{"shared/layer.tar"}},
+		})
+		addFileToTar(t, tw, "manifest.json", mb)
+	}
+	if metaFirst {
+		meta()
+	}
+	for i, l := range layers {
+		addFileToTar(t, tw, names[i], l)
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "shared/layer.tar", Typeflag: tar.TypeSymlink, Linkname: "../" + names[0]}); err != nil {
+		t.Fatal(err)
+	}
+	if !metaFirst {
+		meta()
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// spoolWatcher notes whether anything sat in the staging directory while
+// an archive was read through it.
+type spoolWatcher struct {
+	r       io.Reader
+	spooled bool
+}
+
+func (w *spoolWatcher) Read(p []byte) (int, error) {
+	if m, _ := filepath.Glob(filepath.Join(stagingDir(), "blob-*")); len(m) > 0 {
+		w.spooled = true
+	}
+	return w.r.Read(p)
+}
+
+func assertStagingEmpty(t *testing.T) {
+	t.Helper()
+	if entries, _ := os.ReadDir(stagingDir()); len(entries) != 0 {
+		t.Fatalf("staging dir not cleaned up: %v", entries)
+	}
+}
+
+func TestImportArchiveStreams(t *testing.T) {
+	// larger than is ever kept in memory
+	big := buildTar(t, []tarEntry{{name: "big", body: strings.Repeat("x", maxDocumentSize+1)}})
+	top := buildTar(t, []tarEntry{{name: "top", body: "top"}})
+	for name, metaFirst := range map[string]bool{"manifest first": true, "manifest last": false} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			if err := paths.EnsureDirs(); err != nil {
+				t.Fatal(err)
+			}
+			w := &spoolWatcher{r: bytes.NewReader(saveArchive(t, metaFirst, big, top))}
+			imported, err := importArchive(w, "", planArchive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// layers after the manifest come straight out of the archive
+			if w.spooled == metaFirst {
+				t.Fatalf("spooled = %v", w.spooled)
+			}
+			if len(imported) != 2 || imported[0].NewLayers != 2 || imported[1].NewLayers != 0 {
+				t.Fatalf("imported = %+v", imported)
+			}
+			one, err := LayerDirs("img:1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			two, err := LayerDirs("img:2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(one) != 2 || len(two) != 1 || two[0] != one[1] {
+				t.Fatalf("layers img:1=%v img:2=%v", one, two)
+			}
+			if _, err := os.Stat(filepath.Join(one[0], "top")); err != nil {
+				t.Fatal(err)
+			}
+			assertStagingEmpty(t)
+		})
+	}
+}
+
+func TestImportArchiveCleansUp(t *testing.T) {
+	big := buildTar(t, []tarEntry{{name: "big", body: strings.Repeat("x", maxDocumentSize+1)}})
+	for name, metaFirst := range map[string]bool{"manifest first": true, "manifest last": false} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			if err := paths.EnsureDirs(); err != nil {
+				t.Fatal(err)
+			}
+			archive := saveArchive(t, metaFirst, big, buildTar(t, []tarEntry{{name: "top", body: "payload-1"}}))
+			// the second layer is not the tar its diff-id is of
+			archive = bytes.Replace(archive, []byte("payload-1"), []byte("payload-2"), 1)
+			if _, err := importArchive(bytes.NewReader(archive), "", planArchive); !errors.Is(err, ErrDigestMismatch) {
+				t.Fatalf("err = %v, want ErrDigestMismatch", err)
+			}
+			assertStagingEmpty(t)
+			if _, err := os.Stat(imageRoot("img:1")); !os.IsNotExist(err) {
+				t.Fatalf("img:1 was stored: %v", err)
+			}
+		})
+	}
+}
+
+func TestImportStdin(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+	go func() {
+		w.Write(saveArchive(t, false, buildTar(t, []tarEntry{{name: "f", body: "f"}})))
+		w.Close()
+	}()
+	imported, err := Import("-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != 2 {
+		t.Fatalf("imported = %+v", imported)
+	}
+	if _, err := LayerDirs("img:1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConcurrentImports(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	layer := buildTar(t, []tarEntry{{name: "big", body: strings.Repeat("x", maxDocumentSize+1)}})
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		p := filepath.Join(tmp, string(rune('a'+i))+".tar")
+		if err := os.WriteFile(p, saveArchive(t, false, layer), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = Import(p, "")
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := LayerDirs("img:2"); err != nil {
+		t.Fatal(err)
+	}
+	assertStagingEmpty(t)
+}
@@ -0,0 +1,108 @@
+//go:build linux
+
+package images
+
+import (
+	"archive/tar"
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+func mknod(target string, hdr *tar.Header) error {
+	mode := uint32(hdr.Mode & 0o7777)
+	switch hdr.Typeflag {
+	case tar.TypeChar:
+		mode |= syscall.S_IFCHR
+	case tar.TypeBlock:
+		mode |= syscall.S_IFBLK
+	default:
+		mode |= syscall.S_IFIFO
+	}
+	major, minor := uint64(hdr.Devmajor), uint64(hdr.Devminor)
+	dev := minor&0xff | (major&0xfff)<<8 | (minor&^0xff)<<12 | (major&^0xfff)<<32
+	return syscall.Mknod(target, mode, int(dev))
+}
+
+// setAttrs gives target the owner, mode, xattrs and, except for
+// directories, the times recorded in hdr.
+func setAttrs(target string, hdr *tar.Header) error {
+	if err := ignorePerm(os.Lchown(target, hdr.Uid, hdr.Gid)); err != nil {
+		return err
+	}
+	// after chown, which clears the setuid and setgid bits; symlinks have
+	// no mode of their own
+	if hdr.Typeflag != tar.TypeSymlink {
+		if err := syscall.Chmod(target, uint32(hdr.Mode&0o7777)); err != nil {
+			return err
+		}
+	}
+	// also after chown, which drops security.capability
+	for name, val := range xattrs(hdr) {
+		if err := ignorePerm(lsetxattr(target, name, []byte(val))); err != nil {
+			return err
+		}
+	}
+	if hdr.Typeflag == tar.TypeDir {
+		return nil
+	}
+	return setTimes(target, hdr)
+}
+
+// setTimes sets target's times without following a symlink.
+func setTimes(target string, hdr *tar.Header) error {
+	p, err := syscall.BytePtrFromString(target)
+	if err != nil {
+		return err
+	}
+	ts := [2]syscall.Timespec{
+		syscall.NsecToTimespec(accessTime(hdr).UnixNano()),
+		syscall.NsecToTimespec(hdr.ModTime.UnixNano()),
+	}
+	dirfd := atFDCWD
+	_, _, e := syscall.Syscall6(syscall.SYS_UTIMENSAT, uintptr(dirfd), uintptr(unsafe.Pointer(p)),
+		uintptr(unsafe.Pointer(&ts)), atSymlinkNofollow, 0, 0)
+	if e != 0 {
+		return e
+	}
+	return nil
+}
+
+// not in the syscall package on every architecture
+const (
+	atFDCWD           = -0x64
+	atSymlinkNofollow = 0x100
+)
+
+// lsetxattr is setxattr on the link itself; the syscall package only has
+// the following variant.
+func lsetxattr(path, name string, val []byte) error {
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+	n, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return err
+	}
+	var v unsafe.Pointer
+	if len(val) > 0 {
+		v = unsafe.Pointer(&val[0])
+	}
+	_, _, e := syscall.Syscall6(syscall.SYS_LSETXATTR, uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(n)),
+		uintptr(v), uintptr(len(val)), 0, 0)
+	if e != 0 {
+		return e
+	}
+	return nil
+}
+
+// ignorePerm lets an unprivileged import, or one onto a filesystem without
+// xattrs, go on with whatever metadata it could restore.
+func ignorePerm(err error) error {
+	if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.ENOTSUP) {
+		return nil
+	}
+	return err
+}
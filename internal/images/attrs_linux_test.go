@@ -0,0 +1,111 @@
+//go:build linux
+
+package images
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestExtractPreservesMetadata(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("needs root to restore owners and create devices")
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 600, time.UTC)
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, hdr := range []*tar.Header{
+		{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0o755, ModTime: mtime},
+		{Name: "etc/shadow", Typeflag: tar.TypeReg, Mode: 0o640, Uid: 0, Gid: 42, Size: 2, ModTime: mtime},
+		{Name: "bin/ping", Typeflag: tar.TypeReg, Mode: 0o4755, Uid: 7, Gid: 8, Size: 2, ModTime: mtime,
+			PAXRecords: map[string]string{"SCHILY.xattr.user.note": "hi", "SCHILY.xattr.trusted.overlay.opaque": "y"}},
+		{Name: "bin/ping6", Typeflag: tar.TypeLink, Linkname: "bin/ping"},
+		{Name: "bin/sh", Typeflag: tar.TypeSymlink, Linkname: "ping", Uid: 7, Gid: 8, ModTime: mtime},
+		{Name: "etc/gone", Typeflag: tar.TypeChar, Mode: 0o600},
+		{Name: "run/fifo", Typeflag: tar.TypeFifo, Mode: 0o600},
+	} {
+		hdr.Format = tar.FormatPAX
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Size > 0 {
+			tw.Write([]byte("xx"))
+		}
+	}
+	tw.Close()
+
+	root := t.TempDir()
+	if err := extract(&buf, root, extractOptions{Limits: DefaultLimits}); err != nil {
+		t.Fatal(err)
+	}
+	stat := func(name string) *syscall.Stat_t {
+		t.Helper()
+		var st syscall.Stat_t
+		if err := syscall.Lstat(filepath.Join(root, name), &st); err != nil {
+			t.Fatal(err)
+		}
+		return &st
+	}
+	if st := stat("etc/shadow"); st.Gid != 42 || st.Mode&0o7777 != 0o640 {
+		t.Fatalf("shadow gid %d mode %o", st.Gid, st.Mode&0o7777)
+	}
+	ping := stat("bin/ping")
+	if ping.Uid != 7 || ping.Gid != 8 || ping.Mode&0o7777 != 0o4755 {
+		t.Fatalf("ping uid %d gid %d mode %o", ping.Uid, ping.Gid, ping.Mode&0o7777)
+	}
+	if got := time.Unix(ping.Mtim.Unix()); !got.Equal(mtime) {
+		t.Fatalf("ping mtime %v, want %v", got, mtime)
+	}
+	if st := stat("bin/ping6"); st.Ino != ping.Ino {
+		t.Fatalf("ping6 is not a hard link to ping")
+	}
+	val := make([]byte, 8)
+	if n, err := syscall.Getxattr(filepath.Join(root, "bin/ping"), "user.note", val); err != nil && err != syscall.ENOTSUP || err == nil && string(val[:n]) != "hi" {
+		t.Fatalf("user.note = %q, %v", val[:n], err)
+	}
+	if _, err := syscall.Getxattr(filepath.Join(root, "bin/ping"), "trusted.overlay.opaque", val); err == nil {
+		t.Fatalf("overlay xattr from the archive was applied")
+	}
+	if st := stat("bin/sh"); st.Uid != 7 || !time.Unix(st.Mtim.Unix()).Equal(mtime) {
+		t.Fatalf("symlink uid %d mtime %v", st.Uid, time.Unix(st.Mtim.Unix()))
+	}
+	if st := stat("etc/gone"); st.Mode&syscall.S_IFMT != syscall.S_IFCHR || st.Rdev != 0 {
+		t.Fatalf("etc/gone mode %o rdev %#x", st.Mode, st.Rdev)
+	}
+	if st := stat("run/fifo"); st.Mode&syscall.S_IFMT != syscall.S_IFIFO {
+		t.Fatalf("fifo mode %o", st.Mode)
+	}
+	// set after the entries inside it were created
+	if st := stat("etc"); !time.Unix(st.Mtim.Unix()).Equal(mtime) {
+		t.Fatalf("etc mtime %v", time.Unix(st.Mtim.Unix()))
+	}
+}
+
+func TestExtractSkipsHostDevices(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, hdr := range []*tar.Header{
+		{Name: "dev/null", Typeflag: tar.TypeChar, Mode: 0o666, Devmajor: 1, Devminor: 3},
+		{Name: "dev/sda", Typeflag: tar.TypeBlock, Mode: 0o660, Devmajor: 8},
+		{Name: "dev/loop0", Typeflag: tar.TypeBlock, Mode: 0o660, Devmajor: 7},
+	} {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	root := t.TempDir()
+	if err := extract(&buf, root, extractOptions{Limits: DefaultLimits}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"dev/null", "dev/sda", "dev/loop0"} {
+		if _, err := os.Lstat(filepath.Join(root, name)); !os.IsNotExist(err) {
+			t.Fatalf("%s was created: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+//go:build !linux
+
+package images
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+)
+
+func mknod(target string, hdr *tar.Header) error {
+	return fmt.Errorf("device nodes are only supported on linux")
+}
+
+// setAttrs only restores the mode and times; ownership and xattrs need
+// linux.
+func setAttrs(target string, hdr *tar.Header) error {
+	if hdr.Typeflag == tar.TypeSymlink {
+		return nil
+	}
+	if err := os.Chmod(target, hdr.FileInfo().Mode()&os.ModePerm); err != nil {
+		return err
+	}
+	if hdr.Typeflag == tar.TypeDir {
+		return nil
+	}
+	return setTimes(target, hdr)
+}
+
+func setTimes(target string, hdr *tar.Header) error {
+	if hdr.Typeflag == tar.TypeSymlink {
+		return nil
+	}
+	return os.Chtimes(target, accessTime(hdr), hdr.ModTime)
+}
@@ -0,0 +1,96 @@
+package images
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type compression int
+
+const (
+	compressionUnknown compression = iota
+	compressionNone
+	compressionGzip
+	compressionZstd
+)
+
+func (c compression) String() string {
+	switch c {
+	case compressionNone:
+		return "none"
+	case compressionGzip:
+		return "gzip"
+	case compressionZstd:
+		return "zstd"
+	}
+	return "unknown"
+}
+
+// layerMediaTypes are the layer types import understands and how each is
+// compressed.
+var layerMediaTypes = map[string]compression{
+	"application/vnd.oci.image.layer.v1.tar":                       compressionNone,
+	"application/vnd.oci.image.layer.v1.tar+gzip":                  compressionGzip,
+	"application/vnd.oci.image.layer.v1.tar+zstd":                  compressionZstd,
+	"application/vnd.oci.image.layer.nondistributable.v1.tar":      compressionNone,
+	"application/vnd.oci.image.layer.nondistributable.v1.tar+gzip": compressionGzip,
+	"application/vnd.oci.image.layer.nondistributable.v1.tar+zstd": compressionZstd,
+	"application/vnd.docker.image.rootfs.diff.tar":                 compressionNone,
+	"application/vnd.docker.image.rootfs.diff.tar.gzip":            compressionGzip,
+	"application/vnd.docker.image.rootfs.foreign.diff.tar.gzip":    compressionGzip,
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// sniffCompression tells the compression of a stream by its first bytes.
+func sniffCompression(head []byte) compression {
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		return compressionGzip
+	case bytes.HasPrefix(head, zstdMagic):
+		return compressionZstd
+	}
+	return compressionNone
+}
+
+// decompress returns the uncompressed stream of r. c is the compression
+// the media type promised, or compressionUnknown to go by the magic bytes;
+// a stream that does not start like c promised is refused.
+func decompress(r io.Reader, c compression) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	sniffed := sniffCompression(head)
+	if c == compressionUnknown {
+		c = sniffed
+	} else if c != compressionNone && c != sniffed {
+		return nil, fmt.Errorf("layer is not %s compressed", c)
+	}
+	switch c {
+	case compressionGzip:
+		return gzip.NewReader(br)
+	case compressionZstd:
+		return zstdReader(br)
+	}
+	return io.NopCloser(br), nil
+}
+
+// zstdReader decompresses r as it is read, so the layer is never staged
+// on disk.
+func zstdReader(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
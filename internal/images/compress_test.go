@@ -0,0 +1,176 @@
+package images
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func gzipBytes(b []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(b)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func zstdBytes(t *testing.T) func([]byte) []byte {
+	return func(b []byte) []byte {
+		zw, err := zstd.NewWriter(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zw.Close()
+		return zw.EncodeAll(b, nil)
+	}
+}
+
+func TestSniffCompression(t *testing.T) {
+	cases := map[string]compression{
+		string(gzipBytes([]byte("x"))): compressionGzip,
+		"\x28\xb5\x2f\xfd\x00":         compressionZstd,
+		"etc/passwd\x00\x00":           compressionNone,
+		"":                             compressionNone,
+	}
+	for in, want := range cases {
+		if got := sniffCompression([]byte(in)); got != want {
+			t.Fatalf("sniff(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	plain := buildTar(t, []tarEntry{{name: "f", body: "x"}})
+	for name, c := range map[string]struct {
+		data []byte
+		c    compression
+	}{
+		"plain":         {plain, compressionUnknown},
+		"sniffed gzip":  {gzipBytes(plain), compressionUnknown},
+		"declared gzip": {gzipBytes(plain), compressionGzip},
+	} {
+		r, err := decompress(bytes.NewReader(c.data), c.c)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil || r.Close() != nil || !bytes.Equal(got, plain) {
+			t.Fatalf("%s: decompressed %d bytes, %v", name, len(got), err)
+		}
+	}
+	if _, err := decompress(bytes.NewReader(plain), compressionZstd); err == nil {
+		t.Fatalf("an uncompressed stream declared zstd should be refused")
+	}
+}
+
+func TestImportGzipDockerSave(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	layer := buildTar(t, []tarEntry{{name: "bin/app", body: "app"}})
+	tarPath := filepath.Join(tmp, "img.tar")
+	f, err := os.Create(tarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(f)
+	addFileToTar(t, tw, "l/layer.tar.gz", gzipBytes(layer))
+	addFileToTar(t, tw, "config.json", configFor(layer))
+	mb, _ := json.Marshal([]ManifestEntry{{Config: "config.json", Layers: []string{"l/layer.tar.gz"}}})
+	addFileToTar(t, tw, "manifest.json", mb)
+	tw.Close()
+	f.Close()
+	if _, err := Import(tarPath, "gz"); err != nil {
+		t.Fatal(err)
+	}
+	assertLayerFile(t, "gz", "bin/app", "app")
+}
+
+func TestImportCompressedOCILayers(t *testing.T) {
+	layer := buildTar(t, []tarEntry{{name: "bin/app", body: "app"}})
+	for name, c := range map[string]struct {
+		mediaType string
+		encode    func(*testing.T) func([]byte) []byte
+	}{
+		"gzip": {"application/vnd.oci.image.layer.v1.tar+gzip", func(*testing.T) func([]byte) []byte { return gzipBytes }},
+		"zstd": {"application/vnd.oci.image.layer.v1.tar+zstd", zstdBytes},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tmp := t.TempDir()
+			t.Setenv("HOME", tmp)
+			layout := filepath.Join(tmp, "layout")
+			writeLayout(t, layout, c.mediaType, c.encode(t), layer)
+			if _, err := Import(layout, name); err != nil {
+				t.Fatal(err)
+			}
+			assertLayerFile(t, name, "bin/app", "app")
+		})
+	}
+}
+
+func TestImportCompressedBlobDigest(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	layer := buildTar(t, []tarEntry{{name: "f", body: "x"}})
+	layout := filepath.Join(tmp, "layout")
+	m := writeLayout(t, layout, "application/vnd.oci.image.layer.v1.tar+gzip", gzipBytes, layer)
+	doc, err := readDocument(dirSource(layout), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// same content, different gzip stream: the diff-id still matches but
+	// the blob no longer has the digest it is stored under
+	p := filepath.Join(layout, filepath.FromSlash(mustBlobName(t, doc.Layers[0].Digest)))
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	zw.Comment = "changed"
+	zw.Write(layer)
+	zw.Close()
+	if err := os.WriteFile(p, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Import(layout, "img"); !errors.Is(err, ErrDigestMismatch) {
+		t.Fatalf("err = %v, want ErrDigestMismatch", err)
+	}
+}
+
+func mustBlobName(t *testing.T, digest string) string {
+	t.Helper()
+	p, err := blobName(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func assertLayerFile(t *testing.T, image, name, want string) {
+	t.Helper()
+	dirs, err := LayerDirs(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(dirs[0], name))
+	if err != nil || string(b) != want {
+		t.Fatalf("%s = %q, %v; want %q", name, b, err, want)
+	}
+}
+
+func TestZstdTruncated(t *testing.T) {
+	encode := zstdBytes(t)
+	z := encode(buildTar(t, []tarEntry{{name: "f", body: string(bytes.Repeat([]byte("x"), 1<<16))}}))
+	r, err := decompress(bytes.NewReader(z[:len(z)/2]), compressionUnknown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, rerr := io.ReadAll(r)
+	if cerr := r.Close(); rerr == nil && cerr == nil {
+		t.Fatalf("truncated zstd stream decompressed without error")
+	}
+}
@@ -0,0 +1,252 @@
+package images
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"example.com/containeredu/internal/paths"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	opaqueMarker   = ".wh..wh..opq"
+	// paxXattr prefixes the PAX records that carry extended attributes
+	paxXattr = "SCHILY.xattr."
+)
+
+// Limits bound what a single archive may unpack to.
+type Limits struct {
+	MaxEntries   int
+	MaxFileSize  int64
+	MaxTotalSize int64
+}
+
+// DefaultLimits are generous for real images but stop an archive from
+// filling the disk or the inode table.
+var DefaultLimits = Limits{
+	MaxEntries:   1 << 20,
+	MaxFileSize:  16 << 30,
+	MaxTotalSize: 64 << 30,
+}
+
+var ErrLimit = errors.New("archive exceeds extraction limits")
+
+// extractOptions control how an archive is unpacked.
+type extractOptions struct {
+	Limits Limits
+	// Whiteouts converts .wh. entries to overlayfs whiteouts, as wanted
+	// for image layers.
+	Whiteouts bool
+}
+
+// layerOptions are the options for unpacking an image layer.
+func layerOptions() extractOptions {
+	return extractOptions{Limits: DefaultLimits, Whiteouts: true}
+}
+
+// extract unpacks the tar stream r into dst. Every path is resolved with
+// dst as the root, following symlinks already unpacked but never leaving
+// dst, and the last component is replaced rather than followed.
+func extract(r io.Reader, dst string, opts extractOptions) error {
+	if err := os.MkdirAll(dst, 0o755); err != nil {
+		return err
+	}
+	tr := tar.NewReader(r)
+	var entries int
+	var total int64
+	var dirs []dirEntry
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if entries++; entries > opts.Limits.MaxEntries {
+			return fmt.Errorf("%w: more than %d entries", ErrLimit, opts.Limits.MaxEntries)
+		}
+		if hdr.Size > opts.Limits.MaxFileSize {
+			return fmt.Errorf("%w: %s is %d bytes", ErrLimit, hdr.Name, hdr.Size)
+		}
+		if total += hdr.Size; total > opts.Limits.MaxTotalSize {
+			return fmt.Errorf("%w: more than %d bytes", ErrLimit, opts.Limits.MaxTotalSize)
+		}
+		name, err := entryName(hdr.Name)
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			continue
+		}
+		dir, err := paths.SecureJoin(dst, filepath.Dir(name))
+		if err != nil {
+			return fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+		base := filepath.Base(name)
+		target := filepath.Join(dir, base)
+		// docker and OCI layers mark deletions with .wh. files; overlayfs
+		// wants 0/0 character devices and an opaque xattr instead
+		if opts.Whiteouts && strings.HasPrefix(base, whiteoutPrefix) {
+			if base == opaqueMarker {
+				err = overlayOpaque(dir)
+			} else if victim := strings.TrimPrefix(base, whiteoutPrefix); victim == "." || victim == ".." {
+				err = fmt.Errorf("invalid whiteout")
+			} else {
+				err = overlayWhiteout(filepath.Join(dir, victim))
+			}
+			if err != nil {
+				return fmt.Errorf("whiteout %s: %w", hdr.Name, err)
+			}
+			continue
+		}
+		// a layer is untrusted and must not hand the container the host's
+		// disks or other devices; /dev is set up at run time instead
+		if hostDevice(hdr) {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			// an existing directory is kept; anything else is replaced
+			if fi, err := os.Lstat(target); err == nil && !fi.IsDir() {
+				if err := os.Remove(target); err != nil {
+					return err
+				}
+			}
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+			// later entries change the directory's times again
+			dirs = append(dirs, dirEntry{target, hdr})
+		case tar.TypeReg, tar.TypeRegA, tar.TypeGNUSparse, tar.TypeSymlink, tar.TypeLink,
+			tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return err
+			}
+			if err := replace(target); err != nil {
+				return err
+			}
+			err = create(dst, target, tr, hdr)
+		default:
+			// pax global headers and types with nothing to unpack
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+		// a hard link shares its metadata with the file it points at
+		if hdr.Typeflag != tar.TypeLink {
+			if err := setAttrs(target, hdr); err != nil {
+				return fmt.Errorf("%s: %w", hdr.Name, err)
+			}
+		}
+	}
+	for _, d := range dirs {
+		if err := setTimes(d.path, d.hdr); err != nil {
+			return fmt.Errorf("%s: %w", d.hdr.Name, err)
+		}
+	}
+	return nil
+}
+
+type dirEntry struct {
+	path string
+	hdr  *tar.Header
+}
+
+// create makes the non-directory entry hdr at target.
+func create(root, target string, r io.Reader, hdr *tar.Header) error {
+	switch hdr.Typeflag {
+	case tar.TypeSymlink:
+		return os.Symlink(hdr.Linkname, target)
+	case tar.TypeLink:
+		// the link target names another member of the archive
+		name, err := entryName(hdr.Linkname)
+		if err != nil {
+			return err
+		}
+		dir, err := paths.SecureJoin(root, filepath.Dir(name))
+		if err != nil {
+			return err
+		}
+		return os.Link(filepath.Join(dir, filepath.Base(name)), target)
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		return mknod(target, hdr)
+	}
+	return writeFile(target, r)
+}
+
+// hostDevice reports whether hdr is a block device or a character device
+// other than the 0/0 overlay uses for whiteouts.
+func hostDevice(hdr *tar.Header) bool {
+	return hdr.Typeflag == tar.TypeBlock ||
+		hdr.Typeflag == tar.TypeChar && (hdr.Devmajor != 0 || hdr.Devminor != 0)
+}
+
+// entryName cleans a member name into a path relative to the archive root.
+// Leading slashes are dropped, as tar does; names that climb out of the
+// root are refused.
+func entryName(name string) (string, error) {
+	sep := string(filepath.Separator)
+	rel := filepath.Clean(strings.TrimLeft(filepath.FromSlash(name), sep))
+	if rel == ".." || strings.HasPrefix(rel, ".."+sep) {
+		return "", fmt.Errorf("%s: path escapes the archive root", name)
+	}
+	return rel, nil
+}
+
+// replace removes target unless it is a directory, so a later entry never
+// writes through a symlink left by an earlier one.
+func replace(target string) error {
+	fi, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("%s: cannot replace a directory", target)
+	}
+	return os.Remove(target)
+}
+
+func writeFile(target string, r io.Reader) error {
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// xattrs returns the extended attributes recorded in hdr's PAX records,
+// leaving out overlayfs' own, which a layer must not be able to set.
+func xattrs(hdr *tar.Header) map[string]string {
+	attrs := map[string]string{}
+	for k, v := range hdr.PAXRecords {
+		name, ok := strings.CutPrefix(k, paxXattr)
+		if !ok || strings.HasPrefix(name, "trusted.overlay.") || strings.HasPrefix(name, "user.overlay.") {
+			continue
+		}
+		attrs[name] = v
+	}
+	return attrs
+}
+
+// accessTime is hdr's atime, which only PAX and GNU headers carry.
+func accessTime(hdr *tar.Header) time.Time {
+	if hdr.AccessTime.IsZero() {
+		return hdr.ModTime
+	}
+	return hdr.AccessTime
+}
@@ -0,0 +1,163 @@
+package images
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type tarEntry struct {
+	name     string
+	typ      byte
+	body     string
+	linkname string
+}
+
+func buildTar(t testing.TB, entries []tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		typ := e.typ
+		if typ == 0 {
+			typ = tar.TypeReg
+		}
+		hdr := &tar.Header{Name: e.name, Typeflag: typ, Mode: 0o644, Size: int64(len(e.body)), Linkname: e.linkname}
+		if typ != tar.TypeReg {
+			hdr.Size = 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Size > 0 {
+			if _, err := tw.Write([]byte(e.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// sandbox returns an extraction root with an empty sibling that nothing
+// may ever be written to.
+func sandbox(t testing.TB) (root, outside string) {
+	base := t.TempDir()
+	root = filepath.Join(base, "root")
+	outside = filepath.Join(base, "outside")
+	if err := os.MkdirAll(outside, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return root, outside
+}
+
+func assertEmpty(t testing.TB, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("%s was written to: %v", dir, entries)
+	}
+}
+
+func TestExtractRefusesEscapes(t *testing.T) {
+	cases := map[string][]tarEntry{
+		"dotdot":        {{name: "../outside/pwned", body: "x"}},
+		"nested dotdot": {{name: "a/../../outside/pwned", body: "x"}},
+		"rooted dotdot": {{name: "/../outside/pwned", body: "x"}},
+	}
+	for name, entries := range cases {
+		t.Run(name, func(t *testing.T) {
+			root, outside := sandbox(t)
+			err := extract(bytes.NewReader(buildTar(t, entries)), root, extractOptions{Limits: DefaultLimits})
+			if err == nil {
+				t.Fatalf("escape was not refused")
+			}
+			assertEmpty(t, outside)
+		})
+	}
+}
+
+func TestExtractKeepsSymlinksInRoot(t *testing.T) {
+	root, outside := sandbox(t)
+	entries := []tarEntry{
+		{name: "abs", typ: tar.TypeSymlink, linkname: outside},
+		{name: "abs/pwned", body: "x"},
+		{name: "rel", typ: tar.TypeSymlink, linkname: "../outside"},
+		{name: "rel/pwned", body: "x"},
+		{name: "file", typ: tar.TypeSymlink, linkname: filepath.Join(outside, "target")},
+		{name: "file", body: "replaced"},
+		{name: "/etc/hosts", body: "rooted"},
+	}
+	if err := extract(bytes.NewReader(buildTar(t, entries)), root, extractOptions{Limits: DefaultLimits}); err != nil {
+		t.Fatal(err)
+	}
+	assertEmpty(t, outside)
+	for p, want := range map[string]string{
+		filepath.Join(root, outside, "pwned"):   "x",
+		filepath.Join(root, "outside", "pwned"): "x",
+		filepath.Join(root, "file"):             "replaced",
+		filepath.Join(root, "etc", "hosts"):     "rooted",
+	} {
+		b, err := os.ReadFile(p)
+		if err != nil || string(b) != want {
+			t.Fatalf("%s = %q, %v; want %q", p, b, err, want)
+		}
+	}
+	if fi, err := os.Lstat(filepath.Join(root, "file")); err != nil || !fi.Mode().IsRegular() {
+		t.Fatalf("symlink was written through instead of replaced")
+	}
+}
+
+func TestExtractLimits(t *testing.T) {
+	entries := []tarEntry{{name: "a", body: "12345"}, {name: "b", body: "12345"}}
+	cases := map[string]Limits{
+		"entries":    {MaxEntries: 1, MaxFileSize: 100, MaxTotalSize: 100},
+		"file size":  {MaxEntries: 10, MaxFileSize: 4, MaxTotalSize: 100},
+		"total size": {MaxEntries: 10, MaxFileSize: 100, MaxTotalSize: 9},
+	}
+	for name, lim := range cases {
+		t.Run(name, func(t *testing.T) {
+			root, _ := sandbox(t)
+			err := extract(bytes.NewReader(buildTar(t, entries)), root, extractOptions{Limits: lim})
+			if !errors.Is(err, ErrLimit) {
+				t.Fatalf("err = %v, want ErrLimit", err)
+			}
+		})
+	}
+}
+
+func FuzzExtract(f *testing.F) {
+	f.Add(buildTar(f, []tarEntry{{name: "a/b", body: "x"}}))
+	f.Add(buildTar(f, []tarEntry{{name: "../x", body: "x"}}))
+	f.Add(buildTar(f, []tarEntry{
+		{name: "l", typ: tar.TypeSymlink, linkname: "/.."},
+		{name: "l/x", body: "x"},
+	}))
+	f.Add(buildTar(f, []tarEntry{
+		{name: "d", typ: tar.TypeDir},
+		{name: "d/.wh..wh..opq"},
+		{name: "d/.wh...", body: "x"},
+	}))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		root, outside := sandbox(t)
+		lim := Limits{MaxEntries: 64, MaxFileSize: 1 << 16, MaxTotalSize: 1 << 20}
+		// errors are fine; writing outside root is not
+		_ = extract(bytes.NewReader(data), root, extractOptions{Limits: lim, Whiteouts: true})
+		assertEmpty(t, outside)
+		entries, err := os.ReadDir(filepath.Dir(root))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) > 2 {
+			t.Fatalf("extraction created %v next to the root", entries)
+		}
+	})
+}
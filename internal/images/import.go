@@ -1,13 +1,13 @@
 package images
 
 import (
-	"archive/tar"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"os"
-	"path/filepath"
+	"path"
+	"strings"
 
 	"example.com/containeredu/internal/paths"
 )
@@ -18,145 +18,264 @@ type ManifestEntry struct {
 	Layers   []string `json:"Layers"`
 }
 
-// ImportDockerSaveTar imports a docker save tarball into local image store.
-// It extracts layer tarballs into images/<name>/layers/<n>/ and writes metadata.json.
-func ImportDockerSaveTar(tarPath, name string) error {
+// Imported describes an image stored by an import.
+type Imported struct {
+	Names []string
+	// ID is the digest of the image config.
+	ID        string
+	Layers    int
+	NewLayers int
+}
+
+// ShortID is the abbreviated ID docker shows.
+func (i Imported) ShortID() string {
+	return shortID(i.ID)
+}
+
+func shortID(digest string) string {
+	h := strings.TrimPrefix(digest, "sha256:")
+	if len(h) > 12 {
+		h = h[:12]
+	}
+	return h
+}
+
+// Import imports the images at path. path is a docker save or OCI image
+// layout tarball, "-" for such a tarball on stdin, or an OCI image layout
+// directory. The images are stored under the names the archive gives
+// them, or under name if it is set, in which case the archive must hold a
+// single image.
+func Import(path, name string) ([]Imported, error) {
 	if err := paths.EnsureDirs(); err != nil {
-		return err
+		return nil, err
+	}
+	if name != "" && !ValidName(name) {
+		return nil, fmt.Errorf("invalid image name %q", name)
 	}
-	f, err := os.Open(tarPath)
+	if path == "-" {
+		return importArchive(os.Stdin, name, planArchive)
+	}
+	f, err := os.Open(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer f.Close()
-	tr := tar.NewReader(f)
-
-	var manifest []ManifestEntry
-	tempDir := filepath.Join(os.TempDir(), "cede-import")
-	_ = os.RemoveAll(tempDir)
-	if err := os.MkdirAll(tempDir, 0o755); err != nil {
-		return err
-	}
-	for {
-		hdr, err := tr.Next()
-		if err == io.EOF {
-			break
-		}
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		src := dirSource(path)
+		specs, err := planLayout(src, name)
 		if err != nil {
-			return err
-		}
-		target := filepath.Join(tempDir, hdr.Name)
-		switch hdr.Typeflag {
-		case tar.TypeReg, tar.TypeRegA:
-			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
-				return err
-			}
-			out, err := os.Create(target)
-			if err != nil {
-				return err
-			}
-			if _, err := io.Copy(out, tr); err != nil {
-				out.Close()
-				return err
-			}
-			out.Close()
-		case tar.TypeDir:
-			if err := os.MkdirAll(target, 0o755); err != nil {
-				return err
-			}
-		default:
-			// ignore other types
+			return nil, err
 		}
+		return storeImages(src, specs, nil)
 	}
-	manifestBytes, err := os.ReadFile(filepath.Join(tempDir, "manifest.json"))
+	return importArchive(f, name, planArchive)
+}
+
+// imageSpec is an image an import is going to store.
+type imageSpec struct {
+	names  []string
+	config imageConfig
+	// layers are bottom-most first
+	layers []layerFile
+}
+
+// planArchive plans the import of a docker save or OCI layout archive.
+func planArchive(src source, name string) ([]imageSpec, error) {
+	if exists(src, "manifest.json") {
+		return planDockerSave(src, name)
+	}
+	if exists(src, ociIndex) {
+		return planLayout(src, name)
+	}
+	return nil, errors.New("not an image archive: no manifest.json or index.json")
+}
+
+// planDockerSave plans the import of every image of the docker save archive
+// in src, named by its RepoTags unless name overrides them.
+func planDockerSave(src source, name string) ([]imageSpec, error) {
+	var manifest []ManifestEntry
+	manifestBytes, err := readFile(src, "manifest.json")
 	if err != nil {
-		return fmt.Errorf("manifest.json missing: %w", err)
+		return nil, fmt.Errorf("manifest.json missing: %w", err)
 	}
 	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
-		return err
+		return nil, err
 	}
 	if len(manifest) == 0 {
-		return errors.New("empty manifest")
-	}
-	entry := manifest[0]
-	imgRoot := filepath.Join(paths.ImagesRoot(), name)
-	layersRoot := filepath.Join(imgRoot, "layers")
-	if err := os.MkdirAll(layersRoot, 0o755); err != nil {
-		return err
-	}
-	for i, l := range entry.Layers {
-		src := filepath.Join(tempDir, l)
-		dst := filepath.Join(layersRoot, fmt.Sprintf("%02d", i))
-		if err := os.MkdirAll(dst, 0o755); err != nil {
-			return err
+		return nil, errors.New("empty manifest")
+	}
+	if name != "" && len(manifest) > 1 {
+		return nil, fmt.Errorf("archive holds %d images; a name can only be given to one", len(manifest))
+	}
+	// check every name before storing anything
+	for _, entry := range manifest {
+		for _, tag := range entry.RepoTags {
+			if !ValidName(tag) {
+				return nil, fmt.Errorf("invalid image name %q in manifest.json", tag)
+			}
+		}
+	}
+	var specs []imageSpec
+	for _, entry := range manifest {
+		spec := imageSpec{names: entry.RepoTags}
+		if name != "" {
+			spec.names = []string{name}
+		}
+		if spec.config, err = readConfig(src, entry.Config); err != nil {
+			return nil, err
+		}
+		for _, l := range entry.Layers {
+			spec.layers = append(spec.layers, layerFile{Path: l})
 		}
-		if err := extractTar(src, dst); err != nil {
-			return fmt.Errorf("extract layer %s: %w", l, err)
+		if err := spec.setDiffIDs(); err != nil {
+			return nil, err
 		}
+		specs = append(specs, spec)
 	}
-	meta := struct {
-		Name   string   `json:"name"`
-		Layers []string `json:"layers"`
-	}{
-		Name:   name,
-		Layers: entry.Layers,
+	return specs, nil
+}
+
+// setDiffIDs gives each layer the diff-id the config lists for it.
+func (s *imageSpec) setDiffIDs() error {
+	diffIDs := s.config.RootFS.DiffIDs
+	if len(diffIDs) != len(s.layers) {
+		return fmt.Errorf("config lists %d layers, manifest %d", len(diffIDs), len(s.layers))
 	}
-	metaBytes, _ := json.MarshalIndent(meta, "", "  ")
-	if err := os.WriteFile(filepath.Join(imgRoot, "metadata.json"), metaBytes, 0o644); err != nil {
-		return err
+	// both list layers bottom-most first
+	for i := range s.layers {
+		s.layers[i].DiffID = diffIDs[i]
 	}
-	_ = os.RemoveAll(tempDir)
 	return nil
 }
 
-func extractTar(srcTar, dstDir string) error {
-	f, err := os.Open(srcTar)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	tr := tar.NewReader(f)
-	for {
-		hdr, err := tr.Next()
-		if err == io.EOF {
-			break
+// layerFile is a layer tarball in an archive or layout.
+type layerFile struct {
+	Path string
+	// Digest is the digest of the file itself, if the format records it.
+	Digest string
+	// Compression is what the format says the file is compressed with;
+	// compressionUnknown leaves it to the file's magic bytes.
+	Compression compression
+	// DiffID is the digest of the uncompressed tar, from the config.
+	DiffID string
+}
+
+// storeImages stores the images of specs, reading the layers the store
+// does not have yet from src. stored holds layers an archive import has
+// already stored on the way, so they are still counted as new.
+func storeImages(src source, specs []imageSpec, stored map[string]bool) ([]Imported, error) {
+	var out []Imported
+	for _, spec := range specs {
+		img, err := storeImage(src, spec, stored)
+		if err != nil {
+			return out, err
 		}
+		out = append(out, img)
+	}
+	return out, nil
+}
+
+// storeImage imports the image spec and records it under each of its
+// names, or its short ID if there are none. Layers the store does not have
+// yet are extracted into it, the config is kept as a blob and the image is
+// recorded as a manifest referencing both.
+func storeImage(src source, spec imageSpec, stored map[string]bool) (Imported, error) {
+	var img Imported
+	var m Manifest
+	m.LayerOrder = OrderTopFirst
+	for _, l := range spec.layers {
+		fresh, err := storeLayerFile(src, l)
 		if err != nil {
-			return err
+			return img, fmt.Errorf("extract layer %s: %w", l.Path, err)
 		}
-		target := filepath.Join(dstDir, hdr.Name)
-		switch hdr.Typeflag {
-		case tar.TypeReg, tar.TypeRegA:
-			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
-				return err
-			}
-			out, err := os.Create(target)
-			if err != nil {
-				return err
-			}
-			if _, err := io.Copy(out, tr); err != nil {
-				out.Close()
-				return err
-			}
-			if err := os.Chmod(target, os.FileMode(hdr.Mode)); err != nil {
-				out.Close()
-				return err
-			}
-			out.Close()
-		case tar.TypeDir:
-			if err := os.MkdirAll(target, os.FileMode(hdr.Mode)); err != nil {
-				return err
-			}
-		case tar.TypeSymlink:
-			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
-				return err
-			}
-			if err := os.Symlink(hdr.Linkname, target); err != nil && !os.IsExist(err) {
-				return err
-			}
-		default:
-			// ignore
+		if fresh || stored[l.DiffID] {
+			img.NewLayers++
+			delete(stored, l.DiffID)
 		}
+		m.Layers = append([]string{l.DiffID}, m.Layers...)
 	}
-	return nil
+	img.Layers = len(spec.layers)
+	// stored only once every layer checked out
+	var err error
+	if m.Config, err = WriteBlob(spec.config.raw); err != nil {
+		return img, err
+	}
+	run := spec.config.Config
+	m.Run = &run
+	img.ID = m.Config
+	img.Names = spec.names
+	if len(img.Names) == 0 {
+		img.Names = []string{shortID(m.Config)}
+	}
+	for _, n := range img.Names {
+		m.Name = n
+		if err := SaveManifest(m); err != nil {
+			return img, err
+		}
+	}
+	return img, nil
+}
+
+// storeLayerFile imports the layer l out of src unless the store already
+// has it.
+func storeLayerFile(src source, l layerFile) (bool, error) {
+	if _, err := digestHex(l.DiffID); err != nil {
+		return false, err
+	}
+	if HasLayer(l.DiffID) {
+		return false, nil
+	}
+	r, err := src.open(l.Path)
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	return importLayer(r, l)
+}
+
+// imageConfig is the part of an image config import needs.
+type imageConfig struct {
+	RootFS struct {
+		Type    string   `json:"type"`
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+	Config RunConfig `json:"config"`
+
+	raw []byte
+}
+
+// readConfig reads and checks the config named name in src.
+func readConfig(src source, name string) (imageConfig, error) {
+	var cfg imageConfig
+	if name == "" {
+		return cfg, errors.New("manifest names no config")
+	}
+	b, err := readFile(src, name)
+	if err != nil {
+		return cfg, fmt.Errorf("config %s: %w", name, err)
+	}
+	if want, ok := nameDigest(name); ok {
+		if got := fmt.Sprintf("sha256:%x", sha256.Sum256(b)); got != want {
+			return cfg, fmt.Errorf("config %s: %w: content is %s", name, ErrDigestMismatch, got)
+		}
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return cfg, fmt.Errorf("config %s: %w", name, err)
+	}
+	cfg.raw = b
+	return cfg, nil
+}
+
+// nameDigest returns the digest a file is named after: docker save calls
+// the config <hex>.json, OCI layouts keep blobs at blobs/sha256/<hex>.
+func nameDigest(name string) (string, bool) {
+	d := "sha256:" + strings.TrimSuffix(path.Base(name), ".json")
+	if _, err := digestHex(d); err != nil {
+		return "", false
+	}
+	return d, true
 }
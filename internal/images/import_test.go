@@ -2,9 +2,13 @@ package images
 
 import (
 	"archive/tar"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -40,6 +44,7 @@ func TestImportDockerSaveTar(t *testing.T) {
 	// write layer tar into main tar under name
 	layerName := "abcdef/layer.tar"
 	writeFileToTar(t, tr, layerName, layerTar)
+	writeConfigToTar(t, tr, "config.json", layerTar)
 	// write manifest.json
 	manifest := []ManifestEntry{{
 		Config:   "config.json",
@@ -52,22 +57,22 @@ func TestImportDockerSaveTar(t *testing.T) {
 	f.Close()
 
 	name := "testimage"
-	if err := ImportDockerSaveTar(tarPath, name); err != nil {
+	if _, err := Import(tarPath, name); err != nil {
 		t.Fatalf("import error: %v", err)
 	}
 	// check extraction
 	imgRoot := filepath.Join(paths.ImagesRoot(), name)
-	_, err = os.Stat(filepath.Join(imgRoot, "metadata.json"))
+	_, err = os.Stat(filepath.Join(imgRoot, "manifest.json"))
 	if err != nil {
-		t.Fatalf("metadata not found: %v", err)
+		t.Fatalf("manifest not found: %v", err)
 	}
 	// layer content exists
-	entries, _ := os.ReadDir(filepath.Join(imgRoot, "layers"))
-	if len(entries) == 0 {
-		t.Fatalf("no layers extracted")
+	dirs, err := LayerDirs(name)
+	if err != nil || len(dirs) == 0 {
+		t.Fatalf("no layers extracted: %v", err)
 	}
 	// check file
-	target := filepath.Join(imgRoot, "layers", entries[0].Name(), "hello.txt")
+	target := filepath.Join(dirs[0], "hello.txt")
 	b, err := os.ReadFile(target)
 	if err != nil {
 		t.Fatalf("hello.txt not found: %v", err)
@@ -88,7 +93,7 @@ func TestImportDockerSaveTarMissingManifest(t *testing.T) {
 	addFileToTar(t, tr, "somefile", []byte("x"))
 	tr.Close()
 	f.Close()
-	err = ImportDockerSaveTar(tarPath, "x")
+	_, err = Import(tarPath, "x")
 	if err == nil {
 		t.Fatalf("expected error for missing manifest")
 	}
@@ -109,6 +114,21 @@ func addFileToTar(t *testing.T, tw *tar.Writer, name string, content []byte) {
 	}
 }
 
+// writeConfigToTar adds an image config listing the diff-ids of the layer
+// tarballs at layerTars.
+func writeConfigToTar(t *testing.T, tw *tar.Writer, name string, layerTars ...string) {
+	t.Helper()
+	var layers [][]byte
+	for _, p := range layerTars {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		layers = append(layers, b)
+	}
+	addFileToTar(t, tw, name, configFor(layers...))
+}
+
 func writeFileToTar(t *testing.T, tw *tar.Writer, name string, src string) {
 	t.Helper()
 	data, err := os.ReadFile(src)
@@ -148,8 +168,13 @@ func TestExtractTarWithDifferentEntryTypes(t *testing.T) {
 	
 	// 提取tar文件
 	dstDir := filepath.Join(tmp, "extract")
-	if err := extractTar(tarPath, dstDir); err != nil {
-		t.Fatalf("extractTar error: %v", err)
+	tf, err := os.Open(tarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tf.Close()
+	if err := extract(tf, dstDir, layerOptions()); err != nil {
+		t.Fatalf("extract: %v", err)
 	}
 	
 	// 验证提取结果
@@ -179,7 +204,7 @@ func TestImportDockerSaveTarEmptyManifest(t *testing.T) {
 	f.Close()
 	
 	// 测试导入空manifest的情况
-	err = ImportDockerSaveTar(tarPath, "empty-image")
+	_, err = Import(tarPath, "empty-image")
 	if err == nil {
 		t.Fatalf("expected error for empty manifest, got nil")
 	}
@@ -218,8 +243,13 @@ func TestExtractTarWithFileMode(t *testing.T) {
 	
 	// 提取tar文件
 	dstDir := filepath.Join(tmp, "extract")
-	if err := extractTar(tarPath, dstDir); err != nil {
-		t.Fatalf("extractTar error: %v", err)
+	tf, err := os.Open(tarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tf.Close()
+	if err := extract(tf, dstDir, layerOptions()); err != nil {
+		t.Fatalf("extract: %v", err)
 	}
 	
 	// 验证提取结果
@@ -232,3 +262,303 @@ func TestExtractTarWithFileMode(t *testing.T) {
 	// 只验证文件是否被提取
 }
 
+
+func TestImportDockerSaveTarLayerOrder(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	tarPath := filepath.Join(tmp, "img.tar")
+	f, err := os.Create(tarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(f)
+	var layers, layerTars []string
+	for _, l := range []string{"base", "app"} {
+		p := filepath.Join(tmp, l+".tar")
+		lf, err := os.Create(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lw := tar.NewWriter(lf)
+		addFileToTar(t, lw, l+".txt", []byte(l))
+		lw.Close()
+		lf.Close()
+		writeFileToTar(t, tw, l+"/layer.tar", p)
+		layers = append(layers, l+"/layer.tar")
+		layerTars = append(layerTars, p)
+	}
+	writeConfigToTar(t, tw, "config.json", layerTars...)
+	mb, _ := json.Marshal([]ManifestEntry{{Config: "config.json", Layers: layers}})
+	addFileToTar(t, tw, "manifest.json", mb)
+	tw.Close()
+	f.Close()
+
+	if _, err := Import(tarPath, "ordered"); err != nil {
+		t.Fatalf("import error: %v", err)
+	}
+	m, err := LoadManifest("ordered")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.LayerOrder != OrderTopFirst || len(m.Layers) != 2 {
+		t.Fatalf("manifest = %+v", m)
+	}
+	dirs, err := LayerDirs("ordered")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) != 2 {
+		t.Fatalf("dirs = %v", dirs)
+	}
+	if _, err := os.Stat(filepath.Join(dirs[0], "app.txt")); err != nil {
+		t.Fatalf("top layer should come first: %v", err)
+	}
+}
+
+func TestLayerDirsLegacy(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	root := legacyLayersRoot("legacy")
+	for _, d := range []string{"00", "01", "02"} {
+		if err := os.MkdirAll(filepath.Join(root, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dirs, err := LayerDirs("legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) != 3 || filepath.Base(dirs[0]) != "02" || filepath.Base(dirs[2]) != "00" {
+		t.Fatalf("dirs = %v, want top-most first", dirs)
+	}
+}
+
+func TestImportVerifiesDigests(t *testing.T) {
+	layer := buildTar(t, []tarEntry{{name: "bin/sh", body: "sh"}})
+	tampered := buildTar(t, []tarEntry{{name: "bin/sh", body: "evil"}})
+	good := configFor(layer)
+	goodName := fmt.Sprintf("%x.json", sha256.Sum256(good))
+	cases := map[string]struct {
+		config     []byte
+		configName string
+		layer      []byte
+		wantErr    error
+	}{
+		"ok":               {good, goodName, layer, nil},
+		"tampered layer":   {good, goodName, tampered, ErrDigestMismatch},
+		"tampered config":  {configFor(tampered), goodName, tampered, ErrDigestMismatch},
+		"layer count":      {configFor(layer, layer), "config.json", layer, nil},
+		"missing config":   {nil, "config.json", layer, nil},
+		"malformed diffid": {[]byte(`{"rootfs":{"diff_ids":["sha256:../x"]}}`), "config.json", layer, nil},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			tmp := t.TempDir()
+			t.Setenv("HOME", tmp)
+			tarPath := filepath.Join(tmp, "img.tar")
+			f, err := os.Create(tarPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tw := tar.NewWriter(f)
+			addFileToTar(t, tw, "l/layer.tar", c.layer)
+			if c.config != nil {
+				addFileToTar(t, tw, c.configName, c.config)
+			}
+			mb, _ := json.Marshal([]ManifestEntry{{Config: c.configName, Layers: []string{"l/layer.tar"}}})
+			addFileToTar(t, tw, "manifest.json", mb)
+			tw.Close()
+			f.Close()
+
+			_, err = Import(tarPath, "img")
+			if name == "ok" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				m, _ := LoadManifest("img")
+				if m.Config != "sha256:"+strings.TrimSuffix(goodName, ".json") || m.Layers[0] != fmt.Sprintf("sha256:%x", sha256.Sum256(layer)) {
+					t.Fatalf("manifest = %+v", m)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("import should fail")
+			}
+			if c.wantErr != nil && !errors.Is(err, c.wantErr) {
+				t.Fatalf("err = %v, want %v", err, c.wantErr)
+			}
+			if _, err := LoadManifest("img"); !os.IsNotExist(err) {
+				t.Fatalf("failed import left a manifest: %v", err)
+			}
+			if entries, _ := os.ReadDir(layersDir()); len(entries) != 0 {
+				t.Fatalf("failed import left layers: %v", entries)
+			}
+		})
+	}
+}
+
+// writeMultiSaveTar writes a docker save archive holding one image per
+// entry of tags, all of them on the same base layer, plus an untagged
+// image with only the base layer.
+func writeMultiSaveTar(t *testing.T, path string, tags ...[]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	base := buildTar(t, []tarEntry{{name: "base", body: "base"}})
+	addFileToTar(t, tw, "base/layer.tar", base)
+	var manifest []ManifestEntry
+	for i, repoTags := range tags {
+		top := buildTar(t, []tarEntry{{name: "top", body: fmt.Sprint(i)}})
+		name := fmt.Sprintf("top%d/layer.tar", i)
+		addFileToTar(t, tw, name, top)
+		config := fmt.Sprintf("config%d.json", i)
+		addFileToTar(t, tw, config, configFor(base, top))
+		manifest = append(manifest, ManifestEntry{Config: config, RepoTags: repoTags, Layers: []string{"base/layer.tar", name}})
+	}
+	addFileToTar(t, tw, "base.json", configFor(base))
+	manifest = append(manifest, ManifestEntry{Config: "base.json", Layers: []string{"base/layer.tar"}})
+	mb, _ := json.Marshal(manifest)
+	addFileToTar(t, tw, "manifest.json", mb)
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportMultiImageArchive(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	archive := filepath.Join(tmp, "multi.tar")
+	writeMultiSaveTar(t, archive, []string{"app:1", "app:latest"}, []string{"docker.io/library/tool:2"})
+
+	imported, err := Import(archive, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != 3 {
+		t.Fatalf("imported %d images, want 3", len(imported))
+	}
+	for i, want := range []struct {
+		names         string
+		layers, fresh int
+	}{
+		{"app:1 app:latest", 2, 2},
+		{"docker.io/library/tool:2", 2, 1},
+		{imported[2].ShortID(), 1, 0},
+	} {
+		img := imported[i]
+		if got := strings.Join(img.Names, " "); got != want.names || img.Layers != want.layers || img.NewLayers != want.fresh {
+			t.Errorf("image %d = %s %d/%d layers, want %s %d/%d", i, got, img.NewLayers, img.Layers, want.names, want.fresh, want.layers)
+		}
+	}
+	if len(imported[2].ShortID()) != 12 {
+		t.Errorf("short id %q", imported[2].ShortID())
+	}
+	entries, _ := os.ReadDir(layersDir())
+	if len(entries) != 3 {
+		t.Fatalf("store has %d layers, want 3", len(entries))
+	}
+
+	app, err := LayerDirs("app")
+	if err != nil {
+		t.Fatalf("untagged name does not resolve to latest: %v", err)
+	}
+	tool, err := LayerDirs("docker.io/library/tool:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(app) != 2 || app[1] != tool[1] || app[0] == tool[0] {
+		t.Fatalf("layers app=%v tool=%v", app, tool)
+	}
+	if _, err := LayerDirs("tool"); err == nil {
+		t.Fatal("tool resolved without a latest tag")
+	}
+
+	if _, err := Import(archive, "one"); err == nil {
+		t.Fatal("a single name was given to a multi-image archive")
+	}
+}
+
+func TestImportRejectsBadNames(t *testing.T) {
+	for _, tag := range []string{"../escape", "/abs", "a//b", "layers", "blobs/x", "tmp", "app/manifest.json", "a b", "-x"} {
+		t.Run(tag, func(t *testing.T) {
+			tmp := t.TempDir()
+			t.Setenv("HOME", tmp)
+			archive := filepath.Join(tmp, "bad.tar")
+			writeMultiSaveTar(t, archive, []string{"good:1"}, []string{tag})
+			if _, err := Import(archive, ""); err == nil || !strings.Contains(err.Error(), "invalid image name") {
+				t.Fatalf("err = %v, want invalid image name", err)
+			}
+			// names are checked before anything is stored
+			if _, err := os.Stat(imageRoot("good:1")); !os.IsNotExist(err) {
+				t.Fatalf("good:1 was stored: %v", err)
+			}
+			if _, err := Import(archive, tag); err == nil {
+				t.Fatal("bad --name accepted")
+			}
+		})
+	}
+}
+
+func TestLoadRunConfig(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	layer := buildTar(t, []tarEntry{{name: "f", body: "f"}})
+	var cfg map[string]any
+	json.Unmarshal(configFor(layer), &cfg)
+	cfg["config"] = map[string]any{
+		"Entrypoint":   []string{"/entry"},
+		"Cmd":          []string{"run"},
+		"Env":          []string{"A=1"},
+		"WorkingDir":   "/srv",
+		"User":         "app",
+		"Labels":       map[string]string{"k": "v"},
+		"ExposedPorts": map[string]any{"80/tcp": map[string]any{}},
+	}
+	cb, _ := json.Marshal(cfg)
+	archive := filepath.Join(tmp, "img.tar")
+	f, _ := os.Create(archive)
+	tw := tar.NewWriter(f)
+	addFileToTar(t, tw, "l/layer.tar", layer)
+	addFileToTar(t, tw, "config.json", cb)
+	mb, _ := json.Marshal([]ManifestEntry{{Config: "config.json", RepoTags: []string{"app:latest"}, Layers: []string{"l/layer.tar"}}})
+	addFileToTar(t, tw, "manifest.json", mb)
+	tw.Close()
+	f.Close()
+	if _, err := Import(archive, ""); err != nil {
+		t.Fatal(err)
+	}
+	want := RunConfig{
+		Entrypoint:   []string{"/entry"},
+		Cmd:          []string{"run"},
+		Env:          []string{"A=1"},
+		WorkingDir:   "/srv",
+		User:         "app",
+		Labels:       map[string]string{"k": "v"},
+		ExposedPorts: map[string]struct{}{"80/tcp": {}},
+	}
+	run, err := LoadRunConfig("app")
+	if err != nil || !reflect.DeepEqual(run, want) {
+		t.Fatalf("run config = %+v, %v", run, err)
+	}
+
+	// images imported before the run config was recorded
+	m, _ := LoadManifest("app:latest")
+	m.Run = nil
+	if err := SaveManifest(m); err != nil {
+		t.Fatal(err)
+	}
+	if run, err = LoadRunConfig("app:latest"); err != nil || !reflect.DeepEqual(run, want) {
+		t.Fatalf("run config from blob = %+v, %v", run, err)
+	}
+
+	// built images have none
+	if err := SaveManifest(Manifest{Name: "built", Layers: m.Layers, LayerOrder: OrderTopFirst}); err != nil {
+		t.Fatal(err)
+	}
+	if run, err = LoadRunConfig("built"); err != nil || !reflect.DeepEqual(run, RunConfig{}) {
+		t.Fatalf("built run config = %+v, %v", run, err)
+	}
+}
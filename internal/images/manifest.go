@@ -0,0 +1,324 @@
+package images
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"example.com/containeredu/internal/paths"
+)
+
+// OrderTopFirst is the only layer order written to an image manifest: the
+// first layer is the top-most one, which is also how overlayfs takes
+// lowerdir.
+const OrderTopFirst = "top-first"
+
+// Manifest is an image: the layers it stacks, by diff-id, and its config
+// blob. The layers themselves live in the shared store.
+type Manifest struct {
+	Name       string   `json:"name"`
+	Layers     []string `json:"layers"`
+	LayerOrder string   `json:"layer_order"`
+	// Config is the digest of the image config blob, if the image has one.
+	Config string `json:"config,omitempty"`
+	// Run is how the config says to run the image; images imported before
+	// it was recorded only have it in the config blob.
+	Run *RunConfig `json:"run,omitempty"`
+}
+
+// RunConfig is the part of an image config that says how to run a
+// container of the image, with the field names docker and OCI use.
+type RunConfig struct {
+	User         string              `json:"User,omitempty"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	Env          []string            `json:"Env,omitempty"`
+	Entrypoint   []string            `json:"Entrypoint,omitempty"`
+	Cmd          []string            `json:"Cmd,omitempty"`
+	WorkingDir   string              `json:"WorkingDir,omitempty"`
+	Labels       map[string]string   `json:"Labels,omitempty"`
+}
+
+// nameComponent is one slash-separated part of an image name, such as
+// "docker.io", "library" or "busybox:1.36".
+var nameComponent = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.:@-]*$`)
+
+// reserved are the files an image keeps in its directory, which a nested
+// image name may not reuse.
+var reserved = map[string]bool{
+	"layers":        true,
+	"manifest.json": true,
+	"metadata.json": true,
+}
+
+// ValidName reports whether name can be used for an image. Names are paths
+// under the images root, so they may not climb out of it or take the place
+// of the shared layer and blob store.
+func ValidName(name string) bool {
+	parts := strings.Split(name, "/")
+	switch parts[0] {
+	case "layers", "blobs", "tmp":
+		return false
+	}
+	for _, p := range parts {
+		if reserved[p] || !nameComponent.MatchString(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasTag reports whether name ends in a tag or a digest.
+func hasTag(name string) bool {
+	return strings.Contains(name[strings.LastIndex(name, "/")+1:], ":") || strings.Contains(name, "@")
+}
+
+func imageRoot(name string) string {
+	return filepath.Join(paths.ImagesRoot(), name)
+}
+
+func manifestPath(name string) string {
+	return filepath.Join(imageRoot(name), "manifest.json")
+}
+
+// SaveManifest records m as image m.Name, replacing any earlier image of
+// that name.
+func SaveManifest(m Manifest) error {
+	if !ValidName(m.Name) {
+		return fmt.Errorf("invalid image name %q", m.Name)
+	}
+	p := manifestPath(m.Name)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	b, _ := json.MarshalIndent(m, "", "  ")
+	// unique, so that imports of the same name can run at once; no image
+	// name component starts with a dot
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".manifest-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(b)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), p)
+	}
+	return err
+}
+
+// PruneLegacyLayers deletes the per-image layer directories of image name,
+// stored before the layer store, once the image has a manifest. inUse are
+// the images of the containers still around; their filesystems may stack
+// on those directories, so while one of them is name nothing is deleted.
+func PruneLegacyLayers(name string, inUse []string) error {
+	name, err := resolve(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(legacyLayersRoot(name)); err != nil {
+		return nil
+	}
+	if _, err := os.Stat(manifestPath(name)); err != nil {
+		return nil
+	}
+	for _, u := range inUse {
+		if r, err := resolve(u); err == nil && r == name {
+			return nil
+		}
+	}
+	if err := os.RemoveAll(legacyLayersRoot(name)); err != nil {
+		return err
+	}
+	err = os.Remove(filepath.Join(imageRoot(name), "metadata.json"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func LoadManifest(name string) (Manifest, error) {
+	var m Manifest
+	b, err := os.ReadFile(manifestPath(name))
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return m, fmt.Errorf("image %s: %w", name, err)
+	}
+	return m, nil
+}
+
+// resolve returns the image name stands for: a name without a tag that is
+// not an image stands for its latest tag.
+func resolve(name string) (string, error) {
+	if !ValidName(name) {
+		return "", fmt.Errorf("invalid image name %q", name)
+	}
+	if _, err := os.Stat(imageRoot(name)); os.IsNotExist(err) && !hasTag(name) {
+		name += ":latest"
+	}
+	return name, nil
+}
+
+// LayerDirs returns the layer directories of image name, top-most first.
+func LayerDirs(name string) ([]string, error) {
+	name, err := resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	m, err := LoadManifest(name)
+	if os.IsNotExist(err) {
+		return legacyLayerDirs(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m.LayerOrder != OrderTopFirst {
+		return nil, fmt.Errorf("image %s: unknown layer order %q", name, m.LayerOrder)
+	}
+	if len(m.Layers) == 0 {
+		return nil, fmt.Errorf("image %s has no layers", name)
+	}
+	dirs := make([]string, len(m.Layers))
+	for i, l := range m.Layers {
+		if dirs[i], err = LayerPath(l); err != nil {
+			return nil, fmt.Errorf("image %s: %w", name, err)
+		}
+		if _, err := os.Stat(dirs[i]); err != nil {
+			return nil, fmt.Errorf("image %s: layer %s: %w", name, l, err)
+		}
+	}
+	return dirs, nil
+}
+
+// LoadRunConfig returns how image name says to run it; images built here
+// or stored before configs were kept say nothing.
+func LoadRunConfig(name string) (RunConfig, error) {
+	var run RunConfig
+	name, err := resolve(name)
+	if err != nil {
+		return run, err
+	}
+	m, err := LoadManifest(name)
+	if os.IsNotExist(err) {
+		return run, nil
+	}
+	if err != nil {
+		return run, err
+	}
+	if m.Run != nil {
+		return *m.Run, nil
+	}
+	if m.Config == "" {
+		return run, nil
+	}
+	b, err := ReadBlob(m.Config)
+	if err != nil {
+		return run, fmt.Errorf("image %s: %w", name, err)
+	}
+	var cfg imageConfig
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return run, fmt.Errorf("image %s: config: %w", name, err)
+	}
+	return cfg.Config, nil
+}
+
+// Verify checks image name against the digests recorded when it was
+// stored: the config blob against the manifest, the config's diff-ids
+// against the manifest's layers and each layer's files against the tree
+// digest kept with it.
+func Verify(name string) error {
+	name, err := resolve(name)
+	if err != nil {
+		return err
+	}
+	m, err := LoadManifest(name)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("image %s predates the layer store and has no digests to check", name)
+	}
+	if err != nil {
+		return err
+	}
+	if m.Config != "" {
+		b, err := ReadBlob(m.Config)
+		if err != nil {
+			return fmt.Errorf("image %s: %w", name, err)
+		}
+		if got := fmt.Sprintf("sha256:%x", sha256.Sum256(b)); got != m.Config {
+			return fmt.Errorf("%w: image %s: config is %s, expected %s", ErrDigestMismatch, name, got, m.Config)
+		}
+		var cfg imageConfig
+		if err := json.Unmarshal(b, &cfg); err != nil {
+			return fmt.Errorf("image %s: config: %w", name, err)
+		}
+		// the config lists its layers bottom-most first
+		ids := cfg.RootFS.DiffIDs
+		if len(ids) != len(m.Layers) {
+			return fmt.Errorf("%w: image %s: config lists %d layers, manifest %d", ErrDigestMismatch, name, len(ids), len(m.Layers))
+		}
+		for i, id := range ids {
+			if l := m.Layers[len(m.Layers)-1-i]; l != id {
+				return fmt.Errorf("%w: image %s: layer %d is %s, config says %s", ErrDigestMismatch, name, i, l, id)
+			}
+		}
+	}
+	for _, l := range m.Layers {
+		if err := verifyLayer(l); err != nil {
+			return fmt.Errorf("image %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func legacyLayersRoot(name string) string {
+	return filepath.Join(imageRoot(name), "layers")
+}
+
+// legacyLayerDirs reads images stored before the layer store: layers were
+// numbered directories under the image, bottom-most first, optionally with
+// their order written to metadata.json.
+func legacyLayerDirs(name string) ([]string, error) {
+	root := legacyLayersRoot(name)
+	var meta struct {
+		Layers     []string `json:"layers"`
+		LayerOrder string   `json:"layer_order"`
+	}
+	if b, err := os.ReadFile(filepath.Join(imageRoot(name), "metadata.json")); err == nil {
+		if err := json.Unmarshal(b, &meta); err != nil {
+			return nil, fmt.Errorf("image %s: %w", name, err)
+		}
+	}
+	var layers []string
+	if meta.LayerOrder == OrderTopFirst {
+		layers = meta.Layers
+	} else {
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				layers = append(layers, e.Name())
+			}
+		}
+		sort.Sort(sort.Reverse(sort.StringSlice(layers)))
+	}
+	if len(layers) == 0 {
+		return nil, fmt.Errorf("image %s has no layers", name)
+	}
+	dirs := make([]string, len(layers))
+	for i, l := range layers {
+		dirs[i] = filepath.Join(root, l)
+	}
+	return dirs, nil
+}
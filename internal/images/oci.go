@@ -0,0 +1,176 @@
+package images
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"runtime"
+)
+
+// An OCI image layout is a directory holding an oci-layout marker, an
+// index.json listing images and a blobs/sha256 directory with everything
+// the index refers to, named by digest.
+const (
+	ociLayoutFile = "oci-layout"
+	ociIndex      = "index.json"
+)
+
+// maxDocumentSize bounds the index and manifest blobs read into memory.
+const maxDocumentSize = 4 << 20
+
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *platform         `json:"platform,omitempty"`
+}
+
+type platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// ociDocument is an image index (or docker manifest list) or an image
+// manifest; which one is told by the fields present.
+type ociDocument struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Manifests     []descriptor `json:"manifests"`
+	Config        descriptor   `json:"config"`
+	Layers        []descriptor `json:"layers"`
+}
+
+func (d ociDocument) isIndex() bool {
+	return d.Manifests != nil
+}
+
+// planLayout plans the import of the image of the OCI image layout in src:
+// the first one in the index for this platform, looking through nested
+// indexes and manifest lists. Without a name it is stored under the name
+// the index annotates it with.
+func planLayout(src source, name string) ([]imageSpec, error) {
+	var marker struct {
+		Version string `json:"imageLayoutVersion"`
+	}
+	b, err := readFile(src, ociLayoutFile)
+	if err != nil {
+		return nil, fmt.Errorf("not an OCI image layout: %w", err)
+	}
+	if err := json.Unmarshal(b, &marker); err != nil || marker.Version != "1.0.0" {
+		return nil, fmt.Errorf("unsupported OCI image layout version %q", marker.Version)
+	}
+	b, err = readFile(src, ociIndex)
+	if err != nil {
+		return nil, err
+	}
+	var doc ociDocument
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", ociIndex, err)
+	}
+	var names []string
+	if name != "" {
+		names = []string{name}
+	}
+	for depth := 0; doc.isIndex(); depth++ {
+		if depth > 8 {
+			return nil, errors.New("image index nested too deeply")
+		}
+		d, err := pickManifest(doc.Manifests)
+		if err != nil {
+			return nil, err
+		}
+		if depth == 0 && names == nil {
+			if names, err = annotatedNames(d); err != nil {
+				return nil, err
+			}
+		}
+		if doc, err = readDocument(src, d); err != nil {
+			return nil, err
+		}
+	}
+	spec := imageSpec{names: names}
+	for _, l := range doc.Layers {
+		c, ok := layerMediaTypes[l.MediaType]
+		if !ok {
+			return nil, fmt.Errorf("layer %s: unsupported media type %q", l.Digest, l.MediaType)
+		}
+		p, err := blobName(l.Digest)
+		if err != nil {
+			return nil, err
+		}
+		spec.layers = append(spec.layers, layerFile{Path: p, Digest: l.Digest, Compression: c})
+	}
+	config, err := blobName(doc.Config.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	if spec.config, err = readConfig(src, config); err != nil {
+		return nil, err
+	}
+	if err := spec.setDiffIDs(); err != nil {
+		return nil, err
+	}
+	return []imageSpec{spec}, nil
+}
+
+// annotatedNames returns the name an index entry is annotated with, as
+// containerd and docker write it or else as the OCI reference name. The
+// latter is often a bare tag such as "latest", which names no image.
+func annotatedNames(d descriptor) ([]string, error) {
+	n := d.Annotations["io.containerd.image.name"]
+	if ref := d.Annotations["org.opencontainers.image.ref.name"]; n == "" && hasTag(ref) {
+		n = ref
+	}
+	if n == "" {
+		return nil, nil
+	}
+	if !ValidName(n) {
+		return nil, fmt.Errorf("invalid image name %q in %s", n, ociIndex)
+	}
+	return []string{n}, nil
+}
+
+// pickManifest returns the first entry of an index that is for this
+// platform or does not say.
+func pickManifest(manifests []descriptor) (descriptor, error) {
+	for _, d := range manifests {
+		if d.Platform == nil || d.Platform.OS == "linux" && d.Platform.Architecture == runtime.GOARCH {
+			return d, nil
+		}
+	}
+	return descriptor{}, fmt.Errorf("no image for linux/%s in the index", runtime.GOARCH)
+}
+
+// readDocument reads the index or manifest blob d points at and checks it
+// against d's digest.
+func readDocument(src source, d descriptor) (ociDocument, error) {
+	var doc ociDocument
+	name, err := blobName(d.Digest)
+	if err != nil {
+		return doc, err
+	}
+	b, err := readFile(src, name)
+	if err != nil {
+		return doc, fmt.Errorf("%s: %w", d.Digest, err)
+	}
+	if got := fmt.Sprintf("sha256:%x", sha256.Sum256(b)); got != d.Digest {
+		return doc, fmt.Errorf("%w: %s is %s", ErrDigestMismatch, d.Digest, got)
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return doc, fmt.Errorf("%s: %w", d.Digest, err)
+	}
+	return doc, nil
+}
+
+// blobName is where a layout keeps the blob with digest.
+func blobName(digest string) (string, error) {
+	h, err := digestHex(digest)
+	if err != nil {
+		return "", err
+	}
+	return path.Join("blobs", "sha256", h), nil
+}
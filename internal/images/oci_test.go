@@ -0,0 +1,207 @@
+package images
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// writeLayoutBlob adds b to the layout at dir and returns its descriptor.
+func writeLayoutBlob(t *testing.T, dir, mediaType string, b []byte) descriptor {
+	t.Helper()
+	d := descriptor{MediaType: mediaType, Digest: fmt.Sprintf("sha256:%x", sha256.Sum256(b)), Size: int64(len(b))}
+	p := filepath.Join(dir, "blobs", "sha256", strings.TrimPrefix(d.Digest, "sha256:"))
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// writeLayout writes an OCI layout whose index points at a multi-platform
+// index, in which only the entry for this platform is a real image. Layer
+// blobs are passed through encode when it is set.
+func writeLayout(t *testing.T, dir, layerType string, encode func([]byte) []byte, layers ...[]byte) descriptor {
+	t.Helper()
+	var doc ociDocument
+	doc.SchemaVersion = 2
+	doc.MediaType = "application/vnd.oci.image.manifest.v1+json"
+	doc.Config = writeLayoutBlob(t, dir, "application/vnd.oci.image.config.v1+json", configFor(layers...))
+	for _, l := range layers {
+		if encode != nil {
+			l = encode(l)
+		}
+		doc.Layers = append(doc.Layers, writeLayoutBlob(t, dir, layerType, l))
+	}
+	mb, _ := json.Marshal(doc)
+	manifest := writeLayoutBlob(t, dir, doc.MediaType, mb)
+	manifest.Platform = &platform{OS: "linux", Architecture: runtime.GOARCH}
+	other := descriptor{
+		MediaType: doc.MediaType,
+		Digest:    "sha256:" + strings.Repeat("0", 64),
+		Platform:  &platform{OS: "linux", Architecture: "not-" + runtime.GOARCH},
+	}
+	list, _ := json.Marshal(ociDocument{SchemaVersion: 2, Manifests: []descriptor{other, manifest}})
+	nested := writeLayoutBlob(t, dir, "application/vnd.oci.image.index.v1+json", list)
+	nested.Annotations = map[string]string{"org.opencontainers.image.ref.name": "latest"}
+	index, _ := json.Marshal(ociDocument{SchemaVersion: 2, Manifests: []descriptor{nested}})
+	if err := os.WriteFile(filepath.Join(dir, ociIndex), index, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ociLayoutFile), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return manifest
+}
+
+// tarDir writes the tree at dir to a tarball at dst.
+func tarDir(t *testing.T, dir, dst string) {
+	t.Helper()
+	f, err := os.Create(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		addFileToTar(t, tw, filepath.ToSlash(rel), b)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw.Close()
+}
+
+const ociLayer = "application/vnd.oci.image.layer.v1.tar"
+
+func TestImportOCILayout(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	layout := filepath.Join(tmp, "layout")
+	base := buildTar(t, []tarEntry{{name: "etc/os-release", body: "base"}})
+	app := buildTar(t, []tarEntry{{name: "app", body: "app"}})
+	writeLayout(t, layout, ociLayer, nil, base, app)
+	tarPath := filepath.Join(tmp, "layout.tar")
+	tarDir(t, layout, tarPath)
+
+	for name, src := range map[string]string{"dir": layout, "tar": tarPath} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Import(src, "oci-"+name); err != nil {
+				t.Fatal(err)
+			}
+			dirs, err := LayerDirs("oci-" + name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(dirs) != 2 {
+				t.Fatalf("dirs = %v", dirs)
+			}
+			if _, err := os.Stat(filepath.Join(dirs[0], "app")); err != nil {
+				t.Fatalf("top layer should come first: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(dirs[1], "etc", "os-release")); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestImportOCILayoutNames(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	layout := filepath.Join(tmp, "layout")
+	writeLayout(t, layout, ociLayer, nil, buildTar(t, []tarEntry{{name: "f", body: "x"}}))
+
+	// a bare ref.name tag names no image
+	imported, err := Import(layout, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != 1 || len(imported[0].Names) != 1 || imported[0].Names[0] != imported[0].ShortID() {
+		t.Fatalf("imported = %+v", imported)
+	}
+
+	var index ociDocument
+	b, _ := os.ReadFile(filepath.Join(layout, ociIndex))
+	json.Unmarshal(b, &index)
+	index.Manifests[0].Annotations["io.containerd.image.name"] = "docker.io/library/f:1"
+	b, _ = json.Marshal(index)
+	os.WriteFile(filepath.Join(layout, ociIndex), b, 0o644)
+	if imported, err = Import(layout, ""); err != nil {
+		t.Fatal(err)
+	}
+	if imported[0].Names[0] != "docker.io/library/f:1" || imported[0].NewLayers != 0 {
+		t.Fatalf("imported = %+v", imported)
+	}
+	if _, err := LayerDirs("docker.io/library/f:1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportOCILayoutRejects(t *testing.T) {
+	layer := buildTar(t, []tarEntry{{name: "f", body: "x"}})
+	cases := map[string]struct {
+		layerType string
+		mutate    func(t *testing.T, dir string, manifest descriptor)
+		wantErr   error
+	}{
+		"tampered manifest": {ociLayer, func(t *testing.T, dir string, m descriptor) {
+			p := filepath.Join(dir, "blobs", "sha256", strings.TrimPrefix(m.Digest, "sha256:"))
+			b, _ := os.ReadFile(p)
+			os.WriteFile(p, append(b, ' '), 0o644)
+		}, ErrDigestMismatch},
+		"not compressed as promised": {"application/vnd.oci.image.layer.v1.tar+gzip", nil, nil},
+		"no layout marker": {ociLayer, func(t *testing.T, dir string, m descriptor) {
+			os.Remove(filepath.Join(dir, ociLayoutFile))
+		}, nil},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			tmp := t.TempDir()
+			t.Setenv("HOME", tmp)
+			layout := filepath.Join(tmp, "layout")
+			m := writeLayout(t, layout, c.layerType, nil, layer)
+			if c.mutate != nil {
+				c.mutate(t, layout, m)
+			}
+			_, err := Import(layout, "img")
+			if err == nil {
+				t.Fatalf("import should fail")
+			}
+			if c.wantErr != nil && !errors.Is(err, c.wantErr) {
+				t.Fatalf("err = %v, want %v", err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestImportUnknownArchive(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	p := filepath.Join(tmp, "x.tar")
+	if err := os.WriteFile(p, buildTar(t, []tarEntry{{name: "README", body: "hi"}}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Import(p, "x"); err == nil || !strings.Contains(err.Error(), "not an image archive") {
+		t.Fatalf("err = %v", err)
+	}
+}
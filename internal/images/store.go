@@ -0,0 +1,319 @@
+package images
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"example.com/containeredu/internal/paths"
+)
+
+// The store keeps each layer once, extracted, under layers/sha256/<hex>
+// where hex is the layer's diff-id: the digest of its uncompressed tar.
+// Other content, such as image configs, is kept as-is under
+// blobs/sha256/<hex>. An extracted layer no longer hashes to its diff-id,
+// so the digest of its tree as writeTree writes it is kept under
+// layers/tree/<hex> for Verify to check it against.
+
+func layersDir() string  { return filepath.Join(paths.ImagesRoot(), "layers", "sha256") }
+func treesDir() string   { return filepath.Join(paths.ImagesRoot(), "layers", "tree") }
+func blobsDir() string   { return filepath.Join(paths.ImagesRoot(), "blobs", "sha256") }
+func stagingDir() string { return filepath.Join(paths.ImagesRoot(), "tmp") }
+
+// digestHex checks that digest is a sha256 digest and returns its hex part.
+func digestHex(digest string) (string, error) {
+	h, ok := strings.CutPrefix(digest, "sha256:")
+	if !ok || len(h) != sha256.Size*2 {
+		return "", fmt.Errorf("invalid digest %q", digest)
+	}
+	if _, err := hex.DecodeString(h); err != nil || strings.ToLower(h) != h {
+		return "", fmt.Errorf("invalid digest %q", digest)
+	}
+	return h, nil
+}
+
+// LayerPath is the directory holding the layer with diff-id digest.
+func LayerPath(digest string) (string, error) {
+	h, err := digestHex(digest)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(layersDir(), h), nil
+}
+
+func BlobPath(digest string) (string, error) {
+	h, err := digestHex(digest)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(blobsDir(), h), nil
+}
+
+// HasLayer reports whether the store has the layer with diff-id digest and
+// its tree digest. A layer stored before tree digests were kept counts as
+// missing, so that importing it again records one.
+func HasLayer(digest string) bool {
+	p, err := LayerPath(digest)
+	if err != nil {
+		return false
+	}
+	for _, f := range []string{p, filepath.Join(treesDir(), filepath.Base(p))} {
+		if _, err := os.Stat(f); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteBlob stores data and returns its digest.
+func WriteBlob(data []byte) (string, error) {
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	p, _ := BlobPath(digest)
+	if _, err := os.Stat(p); err == nil {
+		return digest, nil
+	}
+	if err := os.MkdirAll(blobsDir(), 0o755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(blobsDir(), ".tmp-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return "", err
+	}
+	return digest, os.Rename(tmp.Name(), p)
+}
+
+func ReadBlob(digest string) ([]byte, error) {
+	p, err := BlobPath(digest)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(p)
+}
+
+// NewLayerDir returns an empty directory to build a layer in. It is turned
+// into a stored layer by CommitLayer.
+func NewLayerDir() (string, error) {
+	if err := os.MkdirAll(stagingDir(), 0o755); err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp(stagingDir(), "layer-")
+	if err != nil {
+		return "", err
+	}
+	// it becomes the container's "/"
+	if err := os.Chmod(dir, 0o755); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// storeLayer moves the layer built in dir, whose tree digest is tree, into
+// the store under digest. If the store already has it, dir is discarded.
+func storeLayer(dir, digest, tree string) error {
+	dst, err := LayerPath(digest)
+	if err != nil {
+		return err
+	}
+	for _, d := range []string{layersDir(), treesDir()} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			return err
+		}
+	}
+	// recorded first: a stored layer always has its tree digest
+	if err := os.WriteFile(filepath.Join(treesDir(), filepath.Base(dst)), []byte(tree+"\n"), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(dir, dst); err != nil {
+		// someone else stored the same layer first
+		if HasLayer(digest) {
+			return os.RemoveAll(dir)
+		}
+		return err
+	}
+	return nil
+}
+
+// treeDigest hashes the layer tree in dir as writeTree writes it.
+func treeDigest(dir string) (string, error) {
+	h := sha256.New()
+	if err := writeTree(h, dir); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
+
+// verifyLayer checks the stored layer with diff-id digest against the tree
+// digest recorded when it was stored.
+func verifyLayer(digest string) error {
+	p, err := LayerPath(digest)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(filepath.Join(treesDir(), filepath.Base(p)))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("layer %s: no digest recorded", digest)
+	}
+	if err != nil {
+		return err
+	}
+	got, err := treeDigest(p)
+	if err != nil {
+		return fmt.Errorf("layer %s: %w", digest, err)
+	}
+	if want := strings.TrimSpace(string(b)); got != want {
+		return fmt.Errorf("%w: layer %s has changed: files are %s, expected %s", ErrDigestMismatch, digest, got, want)
+	}
+	return nil
+}
+
+// ErrDigestMismatch means content does not hash to the digest it was
+// published under.
+var ErrDigestMismatch = errors.New("digest mismatch")
+
+// importLayer stores the layer tarball l read from r under its diff-id
+// unless the store already has it, and reports whether it did. The file is
+// hashed as it is read and the tar inside as it is extracted; either not
+// matching what l says rejects the layer.
+func importLayer(r io.Reader, l layerFile) (bool, error) {
+	if _, err := digestHex(l.DiffID); err != nil {
+		return false, err
+	}
+	if HasLayer(l.DiffID) {
+		return false, nil
+	}
+	dir, err := NewLayerDir()
+	if err != nil {
+		return false, err
+	}
+	if err := unpackLayer(r, dir, l); err != nil {
+		os.RemoveAll(dir)
+		return false, err
+	}
+	tree, err := treeDigest(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return false, err
+	}
+	if err := storeLayer(dir, l.DiffID, tree); err != nil {
+		os.RemoveAll(dir)
+		return false, err
+	}
+	return true, nil
+}
+
+func unpackLayer(f io.Reader, dir string, l layerFile) error {
+	blob := sha256.New()
+	raw := io.TeeReader(f, blob)
+	tr, err := decompress(raw, l.Compression)
+	if err != nil {
+		return err
+	}
+	diff := sha256.New()
+	r := io.TeeReader(tr, diff)
+	err = extract(r, dir, layerOptions())
+	if err == nil {
+		// the padding after the end-of-archive marker is part of the
+		// digest too
+		_, err = io.Copy(io.Discard, r)
+	}
+	if cerr := tr.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		_, err = io.Copy(io.Discard, raw)
+	}
+	if err != nil {
+		return err
+	}
+	if got := fmt.Sprintf("sha256:%x", blob.Sum(nil)); l.Digest != "" && got != l.Digest {
+		return fmt.Errorf("%w: layer blob is %s, expected %s", ErrDigestMismatch, got, l.Digest)
+	}
+	if got := fmt.Sprintf("sha256:%x", diff.Sum(nil)); got != l.DiffID {
+		return fmt.Errorf("%w: layer is %s, expected %s", ErrDigestMismatch, got, l.DiffID)
+	}
+	return nil
+}
+
+// CommitLayer stores the directory tree built in dir, which must come from
+// NewLayerDir, as a layer and returns its diff-id: the digest of the tree
+// written out as a tar.
+func CommitLayer(dir string) (string, error) {
+	digest, err := treeDigest(dir)
+	if err != nil {
+		return "", err
+	}
+	if err := storeLayer(dir, digest, digest); err != nil {
+		return "", err
+	}
+	return digest, nil
+}
+
+// writeTree writes dir to w as a tar, entries in lexical order so the same
+// tree always gives the same stream. Times and owner names are left out:
+// a rebuild makes the same files at a different time.
+func writeTree(w io.Writer, dir string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == dir {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		var link string
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		hdr.Name = filepath.ToSlash(rel)
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		hdr.Uname, hdr.Gname = "", ""
+		hdr.ModTime, hdr.AccessTime, hdr.ChangeTime = time.Time{}, time.Time{}, time.Time{}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
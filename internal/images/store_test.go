@@ -0,0 +1,197 @@
+package images
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// configFor returns an image config whose diff-ids are those of layers.
+func configFor(layers ...[]byte) []byte {
+	var cfg imageConfig
+	cfg.RootFS.Type = "layers"
+	for _, l := range layers {
+		cfg.RootFS.DiffIDs = append(cfg.RootFS.DiffIDs, fmt.Sprintf("sha256:%x", sha256.Sum256(l)))
+	}
+	b, _ := json.Marshal(cfg)
+	return b
+}
+
+// writeSaveTar writes a docker save archive with one layer per entry of
+// layers, each holding a single file of that name.
+func writeSaveTar(t *testing.T, path string, layers ...string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	var names []string
+	var bodies [][]byte
+	for _, l := range layers {
+		body := buildTar(t, []tarEntry{{name: l, body: l}})
+		addFileToTar(t, tw, l+"/layer.tar", body)
+		names = append(names, l+"/layer.tar")
+		bodies = append(bodies, body)
+	}
+	addFileToTar(t, tw, "config.json", configFor(bodies...))
+	mb, _ := json.Marshal([]ManifestEntry{{Config: "config.json", Layers: names}})
+	addFileToTar(t, tw, "manifest.json", mb)
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportSharesLayers(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	writeSaveTar(t, filepath.Join(tmp, "a.tar"), "base", "a")
+	writeSaveTar(t, filepath.Join(tmp, "b.tar"), "base", "b")
+	if _, err := Import(filepath.Join(tmp, "a.tar"), "a"); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := LoadManifest("a")
+	base, err := LayerPath(a.Layers[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a layer already in the store must not be extracted again
+	if err := os.WriteFile(filepath.Join(base, "marker"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Import(filepath.Join(tmp, "b.tar"), "b"); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := LoadManifest("b")
+	if b.Layers[1] != a.Layers[1] || b.Layers[0] == a.Layers[0] {
+		t.Fatalf("layers a=%v b=%v", a.Layers, b.Layers)
+	}
+	if _, err := os.Stat(filepath.Join(base, "marker")); err != nil {
+		t.Fatalf("shared layer was extracted again: %v", err)
+	}
+	entries, _ := os.ReadDir(layersDir())
+	if len(entries) != 3 {
+		t.Fatalf("store has %d layers, want 3", len(entries))
+	}
+	if cfg, err := ReadBlob(a.Config); err != nil || !strings.Contains(string(cfg), a.Layers[0]) {
+		t.Fatalf("config blob = %q, %v", cfg, err)
+	}
+	if tmpEntries, _ := os.ReadDir(stagingDir()); len(tmpEntries) != 0 {
+		t.Fatalf("staging dir not cleaned up: %v", tmpEntries)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	writeSaveTar(t, filepath.Join(tmp, "a.tar"), "base", "a")
+	if _, err := Import(filepath.Join(tmp, "a.tar"), "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify("a"); err != nil {
+		t.Fatalf("verify fresh import: %v", err)
+	}
+	m, _ := LoadManifest("a")
+	top, _ := LayerPath(m.Layers[0])
+	if err := os.WriteFile(filepath.Join(top, "a"), []byte("changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify("a"); !errors.Is(err, ErrDigestMismatch) {
+		t.Fatalf("verify changed layer: err = %v, want ErrDigestMismatch", err)
+	}
+	cfg, _ := BlobPath(m.Config)
+	if err := os.WriteFile(cfg, []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify("a"); !errors.Is(err, ErrDigestMismatch) {
+		t.Fatalf("verify changed config: err = %v, want ErrDigestMismatch", err)
+	}
+}
+
+func TestCommitLayer(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	build := func(mtime time.Time) string {
+		dir, err := NewLayerDir()
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.MkdirAll(filepath.Join(dir, "bin"), 0o755)
+		os.WriteFile(filepath.Join(dir, "bin", "app"), []byte("app"), 0o755)
+		os.Chtimes(filepath.Join(dir, "bin", "app"), mtime, mtime)
+		os.Chtimes(filepath.Join(dir, "bin"), mtime, mtime)
+		digest, err := CommitLayer(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return digest
+	}
+	// a rebuild of the same tree at another time
+	first, second := build(testTime), build(testTime.Add(time.Hour))
+	if first != second {
+		t.Fatalf("same tree gave digests %s and %s", first, second)
+	}
+	p, _ := LayerPath(first)
+	if b, err := os.ReadFile(filepath.Join(p, "bin", "app")); err != nil || string(b) != "app" {
+		t.Fatalf("committed layer content = %q, %v", b, err)
+	}
+	if fi, err := os.Stat(p); err != nil || fi.Mode().Perm() != 0o755 {
+		t.Fatalf("layer root mode = %v, %v", fi.Mode(), err)
+	}
+}
+
+var testTime = time.Date(2021, 5, 6, 7, 8, 9, 0, time.UTC)
+
+func TestDigestHex(t *testing.T) {
+	good := "sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	if _, err := digestHex(good); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []string{"", "sha256:abc", "md5:" + good[7:], "sha256:../../../../etc/passwd/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "sha256:" + "0123456789ABCDEF0123456789abcdef0123456789abcdef0123456789abcdef"} {
+		if _, err := digestHex(d); err == nil {
+			t.Fatalf("%q should be rejected", d)
+		}
+	}
+}
+
+func TestPruneLegacyLayers(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	root := legacyLayersRoot("old")
+	if err := os.MkdirAll(filepath.Join(root, "00"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := NewLayerDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := CommitLayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveManifest(Manifest{Name: "old", Layers: []string{digest}, LayerOrder: OrderTopFirst}); err != nil {
+		t.Fatal(err)
+	}
+	// containers made before the re-import may still stack on them
+	if _, err := os.Stat(root); err != nil {
+		t.Fatalf("saving the manifest removed the old layers: %v", err)
+	}
+	if err := PruneLegacyLayers("old", []string{"other", "old"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(root); err != nil {
+		t.Fatalf("old layers removed while in use: %v", err)
+	}
+	if err := PruneLegacyLayers("old", []string{"other"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(root); !os.IsNotExist(err) {
+		t.Fatalf("old layers left behind: %v", err)
+	}
+}
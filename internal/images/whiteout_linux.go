@@ -0,0 +1,43 @@
+//go:build linux
+
+package images
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// overlayWhiteout replaces target with the 0/0 character device overlayfs
+// uses to hide a file of the layers below. Without the privilege to make
+// it the .wh. file is kept instead; the vfs driver reads either, the
+// overlay driver refuses such layers.
+func overlayWhiteout(target string) error {
+	dir := filepath.Dir(target)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+	err := syscall.Mknod(target, syscall.S_IFCHR, 0)
+	if err == syscall.EPERM {
+		err = os.WriteFile(filepath.Join(dir, whiteoutPrefix+filepath.Base(target)), nil, 0o644)
+	}
+	return err
+}
+
+// overlayOpaque marks dir so overlayfs hides what the layers below have in
+// it. The trusted namespace needs CAP_SYS_ADMIN; without it the user
+// namespace one is used instead and the overlay driver mounts such layers
+// with userxattr.
+func overlayOpaque(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	err := syscall.Setxattr(dir, "trusted.overlay.opaque", []byte("y"), 0)
+	if err == syscall.EPERM {
+		err = syscall.Setxattr(dir, "user.overlay.opaque", []byte("y"), 0)
+	}
+	return err
+}
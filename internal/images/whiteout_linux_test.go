@@ -0,0 +1,90 @@
+//go:build linux
+
+package images
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestExtractTarWhiteouts(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("needs root to create whiteout devices")
+	}
+	tmp := t.TempDir()
+	tarPath := filepath.Join(tmp, "layer.tar")
+	f, err := os.Create(tarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(f)
+	addFileToTar(t, tw, "etc/.wh.passwd", nil)
+	addFileToTar(t, tw, "var/cache/.wh..wh..opq", nil)
+	addFileToTar(t, tw, "var/cache/kept", []byte("x"))
+	tw.Close()
+	f.Close()
+
+	dst := filepath.Join(tmp, "extract")
+	tf, err := os.Open(tarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tf.Close()
+	if err := extract(tf, dst, layerOptions()); err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	var st syscall.Stat_t
+	if err := syscall.Lstat(filepath.Join(dst, "etc", "passwd"), &st); err != nil {
+		t.Fatalf("whiteout not created: %v", err)
+	}
+	if st.Mode&syscall.S_IFMT != syscall.S_IFCHR || st.Rdev != 0 {
+		t.Fatalf("whiteout mode %o rdev %d, want 0/0 char device", st.Mode, st.Rdev)
+	}
+	if _, err := os.Lstat(filepath.Join(dst, "etc", ".wh.passwd")); !os.IsNotExist(err) {
+		t.Fatalf(".wh. file should not be extracted")
+	}
+	buf := make([]byte, 4)
+	n, err := syscall.Getxattr(filepath.Join(dst, "var", "cache"), "trusted.overlay.opaque", buf)
+	if err == syscall.ENOTSUP {
+		t.Skip("filesystem has no trusted xattrs")
+	}
+	if err != nil || string(buf[:n]) != "y" {
+		t.Fatalf("opaque xattr = %q, %v", buf[:n], err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "var", "cache", ".wh..wh..opq")); !os.IsNotExist(err) {
+		t.Fatalf("opaque marker should not be extracted")
+	}
+	if _, err := os.Stat(filepath.Join(dst, "var", "cache", "kept")); err != nil {
+		t.Fatalf("file next to the opaque marker missing: %v", err)
+	}
+}
+
+func TestExtractTarWhiteoutsUnprivileged(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can create whiteout devices")
+	}
+	tmp := t.TempDir()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	addFileToTar(t, tw, "etc/passwd", []byte("x"))
+	addFileToTar(t, tw, "etc/.wh.passwd", nil)
+	tw.Close()
+	dst := filepath.Join(tmp, "extract")
+	if err := extract(&buf, dst, layerOptions()); err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	var st syscall.Stat_t
+	if err := syscall.Lstat(filepath.Join(dst, "etc", "passwd"), &st); err == nil {
+		if st.Mode&syscall.S_IFMT == syscall.S_IFCHR && st.Rdev == 0 {
+			t.Skip("kernel lets unprivileged users create whiteout devices")
+		}
+		t.Fatalf("whited out file left behind")
+	}
+	if _, err := os.Lstat(filepath.Join(dst, "etc", ".wh.passwd")); err != nil {
+		t.Fatalf(".wh. file should be kept without a whiteout device: %v", err)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package images
+
+import "fmt"
+
+var errWhiteout = fmt.Errorf("layer whiteouts are only supported on linux")
+
+func overlayWhiteout(target string) error { return errWhiteout }
+func overlayOpaque(dir string) error      { return errWhiteout }
@@ -0,0 +1,167 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"example.com/containeredu/internal/paths"
+)
+
+// Entry is one line of container output. The JSON form matches the
+// docker json-file format: {"log":"...\n","stream":"stdout","time":"..."}.
+type Entry struct {
+	Log    string    `json:"log"`
+	Stream string    `json:"stream"`
+	Time   time.Time `json:"time"`
+}
+
+// Path returns the log file of a container.
+func Path(containerID string) string {
+	return filepath.Join(paths.ContainersRoot(), containerID, "container.log")
+}
+
+// Rotation bounds the disk space of a log. Once the file would grow past
+// MaxSize it is renamed to <path>.1 (shifting older files up) and only
+// MaxFiles files are kept in total. A zero MaxSize disables rotation.
+type Rotation struct {
+	MaxSize  int64
+	MaxFiles int
+}
+
+// File appends entries to a JSON-lines log file. It is safe for
+// concurrent use by the stdout and stderr copiers.
+type File struct {
+	mu   sync.Mutex
+	path string
+	rot  Rotation
+	f    *os.File
+	size int64
+}
+
+func Create(path string, rot Rotation) (*File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	lf := &File{path: path, rot: rot}
+	if err := lf.open(os.O_APPEND); err != nil {
+		return nil, err
+	}
+	return lf, nil
+}
+
+func (f *File) open(mode int) error {
+	fh, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|mode, 0o640)
+	if err != nil {
+		return err
+	}
+	fi, err := fh.Stat()
+	if err != nil {
+		fh.Close()
+		return err
+	}
+	f.f = fh
+	f.size = fi.Size()
+	return nil
+}
+
+func (f *File) Log(e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.rot.MaxSize > 0 && f.size > 0 && f.size+int64(len(b)) > f.rot.MaxSize {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := f.f.Write(b)
+	f.size += int64(n)
+	return err
+}
+
+func (f *File) rotate() error {
+	if err := f.f.Close(); err != nil {
+		return err
+	}
+	if f.rot.MaxFiles <= 1 {
+		return f.open(os.O_TRUNC)
+	}
+	_ = os.Remove(rotatedPath(f.path, f.rot.MaxFiles-1))
+	for i := f.rot.MaxFiles - 2; i >= 1; i-- {
+		if err := os.Rename(rotatedPath(f.path, i), rotatedPath(f.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(f.path, rotatedPath(f.path, 1)); err != nil {
+		return err
+	}
+	return f.open(os.O_APPEND)
+}
+
+func rotatedPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.f.Close()
+}
+
+// MaxLineSize caps the Log of one Entry. Longer lines are split into
+// several entries, the way docker does, so a line that never ends cannot
+// grow the buffer without bound.
+const MaxLineSize = 16 << 10
+
+// LineWriter turns a byte stream into one Entry per line. A trailing
+// partial line is held back until it is completed, reaches MaxLineSize or
+// the writer is closed.
+type LineWriter struct {
+	stream string
+	log    func(Entry) error
+	buf    []byte
+}
+
+func NewLineWriter(stream string, log func(Entry) error) *LineWriter {
+	return &LineWriter{stream: stream, log: log}
+}
+
+func (w *LineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		n := bytes.IndexByte(w.buf, '\n') + 1
+		if n == 0 || n > MaxLineSize {
+			if len(w.buf) < MaxLineSize {
+				break
+			}
+			n = MaxLineSize
+		}
+		if err := w.emit(w.buf[:n]); err != nil {
+			return len(p), err
+		}
+		w.buf = w.buf[n:]
+	}
+	return len(p), nil
+}
+
+// Close flushes a pending partial line.
+func (w *LineWriter) Close() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	err := w.emit(w.buf)
+	w.buf = nil
+	return err
+}
+
+func (w *LineWriter) emit(line []byte) error {
+	return w.log(Entry{Log: string(line), Stream: w.stream, Time: time.Now().UTC()})
+}
@@ -0,0 +1,191 @@
+package logs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func collect(t *testing.T, path string, opts ReadOptions) []Entry {
+	t.Helper()
+	var out []Entry
+	if err := Read(path, opts, func(e Entry) error {
+		out = append(out, e)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestLineWriterSplitsLines(t *testing.T) {
+	var got []Entry
+	w := NewLineWriter("stdout", func(e Entry) error {
+		got = append(got, e)
+		return nil
+	})
+	w.Write([]byte("one\ntw"))
+	w.Write([]byte("o\nthree"))
+	if len(got) != 2 {
+		t.Fatalf("expected 2 complete lines, got %d", len(got))
+	}
+	w.Close()
+	if len(got) != 3 || got[0].Log != "one\n" || got[1].Log != "two\n" || got[2].Log != "three" {
+		t.Fatalf("unexpected entries: %+v", got)
+	}
+	if got[0].Stream != "stdout" || got[0].Time.IsZero() {
+		t.Fatalf("missing stream or time: %+v", got[0])
+	}
+}
+
+func TestLineWriterSplitsLongLines(t *testing.T) {
+	var got []string
+	w := NewLineWriter("stdout", func(e Entry) error {
+		got = append(got, e.Log)
+		return nil
+	})
+	long := strings.Repeat("x", 2*MaxLineSize+10)
+	for i := 0; i < len(long); i += 1000 {
+		w.Write([]byte(long[i:min(i+1000, len(long))]))
+	}
+	// held back no further than the cap
+	if len(got) != 2 || len(got[0]) != MaxLineSize || len(got[1]) != MaxLineSize {
+		t.Fatalf("got %d entries before the line ended", len(got))
+	}
+	w.Write([]byte("\n" + long + "\n"))
+	w.Close()
+	if len(got) != 6 || got[2] != "xxxxxxxxxx\n" || len(got[5]) != 11 || strings.Join(got, "") != long+"\n"+long+"\n" {
+		t.Fatalf("entries: %d", len(got))
+	}
+}
+
+func TestFileRoundTripWithTailAndSince(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "c", "container.log")
+	f, err := Create(path, Rotation{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, s := range []string{"a\n", "b\n", "c\n", "d\n"} {
+		stream := "stdout"
+		if i%2 == 1 {
+			stream = "stderr"
+		}
+		if err := f.Log(Entry{Log: s, Stream: stream, Time: base.Add(time.Duration(i) * time.Minute)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Close()
+	all := collect(t, path, ReadOptions{Tail: -1})
+	if len(all) != 4 || all[1].Stream != "stderr" {
+		t.Fatalf("unexpected entries: %+v", all)
+	}
+	last := collect(t, path, ReadOptions{Tail: 2})
+	if len(last) != 2 || last[0].Log != "c\n" || last[1].Log != "d\n" {
+		t.Fatalf("tail 2: %+v", last)
+	}
+	since := collect(t, path, ReadOptions{Tail: -1, Since: base.Add(90 * time.Second)})
+	if len(since) != 2 || since[0].Log != "c\n" {
+		t.Fatalf("since: %+v", since)
+	}
+	if n := len(collect(t, path, ReadOptions{Tail: 0})); n != 0 {
+		t.Fatalf("tail 0 returned %d entries", n)
+	}
+}
+
+func TestReadFollowPicksUpNewLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "container.log")
+	f, err := Create(path, Rotation{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Log(Entry{Log: "first\n", Stream: "stdout", Time: time.Now()})
+	stop := make(chan struct{})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		// write a line in two pieces to exercise partial line handling
+		raw, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+		raw.WriteString(`{"log":"sec`)
+		time.Sleep(250 * time.Millisecond)
+		raw.WriteString(`ond\n","stream":"stderr","time":"2024-01-01T00:00:00Z"}` + "\n")
+		raw.Close()
+		time.Sleep(250 * time.Millisecond)
+		close(stop)
+	}()
+	done := func() bool {
+		select {
+		case <-stop:
+			return true
+		default:
+			return false
+		}
+	}
+	var lines []string
+	err = Read(path, ReadOptions{Tail: -1, Follow: true, Done: done}, func(e Entry) error {
+		lines = append(lines, e.Stream+":"+e.Log)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(lines, "") != "stdout:first\nstderr:second\n" {
+		t.Fatalf("unexpected follow output: %q", lines)
+	}
+}
+
+func TestRotationKeepsMaxFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "container.log")
+	f, err := Create(path, Rotation{MaxSize: 200, MaxFiles: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := f.Log(Entry{Log: strings.Repeat("x", 40) + "\n", Stream: "stdout", Time: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Close()
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		fi, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("missing %s: %v", p, err)
+		}
+		if fi.Size() > 200 {
+			t.Fatalf("%s exceeds max size: %d", p, fi.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("too many files kept")
+	}
+	if got := rotatedFiles(path); len(got) != 2 || got[0] != path+".2" {
+		t.Fatalf("rotated files order: %v", got)
+	}
+	// entries come back oldest first across files
+	all := collect(t, path, ReadOptions{Tail: -1})
+	for i := 1; i < len(all); i++ {
+		if all[i].Time.Before(all[i-1].Time) {
+			t.Fatalf("entries out of order at %d", i)
+		}
+	}
+}
+
+func TestRotationSingleFileTruncates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "container.log")
+	f, err := Create(path, Rotation{MaxSize: 150, MaxFiles: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		f.Log(Entry{Log: "line\n", Stream: "stdout", Time: time.Now()})
+	}
+	f.Close()
+	if fi, _ := os.Stat(path); fi.Size() > 150 {
+		t.Fatalf("file not truncated: %d", fi.Size())
+	}
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Fatalf("max-file 1 must not keep rotated files")
+	}
+}
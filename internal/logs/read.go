@@ -0,0 +1,173 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReadOptions selects which entries Read delivers.
+type ReadOptions struct {
+	// Tail limits the output to the last Tail entries; negative means all.
+	Tail  int
+	Since time.Time
+	// Follow keeps reading new entries until Done reports true.
+	Follow bool
+	Done   func() bool
+}
+
+const followInterval = 200 * time.Millisecond
+
+// Read calls fn for every entry of the log file at path, including its
+// rotated predecessors, that matches opts.
+func Read(path string, opts ReadOptions, fn func(Entry) error) error {
+	since := func(e Entry) bool {
+		return opts.Since.IsZero() || !e.Time.Before(opts.Since)
+	}
+	var tail []Entry
+	keep := func(e Entry) error {
+		if !since(e) {
+			return nil
+		}
+		if opts.Tail < 0 {
+			return fn(e)
+		}
+		if opts.Tail == 0 {
+			return nil
+		}
+		if len(tail) == opts.Tail {
+			tail = tail[1:]
+		}
+		tail = append(tail, e)
+		return nil
+	}
+	emit := func(e Entry) error {
+		if !since(e) {
+			return nil
+		}
+		return fn(e)
+	}
+	for _, p := range rotatedFiles(path) {
+		if err := readFile(p, keep); err != nil {
+			return err
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { f.Close() }()
+	r := &lineReader{r: f}
+	if err := r.next(keep); err != nil {
+		return err
+	}
+	for _, e := range tail {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	for opts.Follow {
+		// sample Done before reading so lines written just before the
+		// container exited are still delivered
+		done := opts.Done != nil && opts.Done()
+		if err := r.next(emit); err != nil {
+			return err
+		}
+		// after a rotation the open file is the renamed old log, which has
+		// just been drained; continue with the new one
+		if cur, err := os.Stat(path); err == nil {
+			if old, err := f.Stat(); err == nil && !os.SameFile(old, cur) {
+				if nf, err := os.Open(path); err == nil {
+					f.Close()
+					f = nf
+					r = &lineReader{r: f}
+					if err := r.next(emit); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		if done {
+			break
+		}
+		time.Sleep(followInterval)
+	}
+	return nil
+}
+
+func readFile(path string, fn func(Entry) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	return (&lineReader{r: f}).next(fn)
+}
+
+// rotatedFiles lists <path>.N files, oldest (highest N) first.
+func rotatedFiles(path string) []string {
+	matches, _ := filepath.Glob(path + ".*")
+	type rotated struct {
+		n    int
+		path string
+	}
+	var out []rotated
+	for _, m := range matches {
+		n, err := strconv.Atoi(strings.TrimPrefix(m, path+"."))
+		if err != nil || n <= 0 {
+			continue
+		}
+		out = append(out, rotated{n, m})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].n > out[j].n })
+	paths := make([]string, len(out))
+	for i, r := range out {
+		paths[i] = r.path
+	}
+	return paths
+}
+
+// lineReader decodes complete JSON lines and keeps a trailing partial line
+// until the writer finishes it.
+type lineReader struct {
+	r       io.Reader
+	pending []byte
+}
+
+func (l *lineReader) next(fn func(Entry) error) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := l.r.Read(buf)
+		l.pending = append(l.pending, buf[:n]...)
+		for {
+			i := bytes.IndexByte(l.pending, '\n')
+			if i < 0 {
+				break
+			}
+			line := l.pending[:i]
+			l.pending = l.pending[i+1:]
+			var e Entry
+			if json.Unmarshal(line, &e) != nil {
+				continue
+			}
+			if ferr := fn(e); ferr != nil {
+				return ferr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
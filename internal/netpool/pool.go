@@ -54,6 +54,9 @@ func ensureLoaded() error {
 
 func save() error {
 	fp := filePath()
+	if err := os.MkdirAll(filepath.Dir(fp), 0o755); err != nil {
+		return err
+	}
 	b, _ := json.MarshalIndent(data, "", "  ")
 	return os.WriteFile(fp, b, 0o644)
 }
@@ -5,15 +5,59 @@ package overlay
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 	"syscall"
 )
 
+// Switch is an overlayfs feature that can be forced on or off; the zero
+// value leaves the kernel's default.
+type Switch int
+
+const (
+	Default Switch = iota
+	On
+	Off
+)
+
+func (s Switch) String() string {
+	switch s {
+	case On:
+		return "on"
+	case Off:
+		return "off"
+	}
+	return "default"
+}
+
+// Options are the overlayfs mount options cede knows how to set.
+type Options struct {
+	// Index controls the inode index used to keep hard links intact
+	// across copy-up.
+	Index Switch
+	// Metacopy copies up only metadata on chmod/chown until data changes.
+	Metacopy Switch
+	// Volatile skips all syncs to the upper layer; after a crash the
+	// container's writes are not reliable.
+	Volatile bool
+	// UserXattr stores overlay's private xattrs in the user.overlay.*
+	// namespace, as needed for mounts inside a user namespace.
+	UserXattr bool
+}
+
 type MountSpec struct {
+	// LowerDirs are the read-only layers, top-most first.
 	LowerDirs []string
 	UpperDir  string
 	WorkDir   string
 	MountDir  string
+	Options   Options
+	// LinkDir is where short symlinks to the layers are created when
+	// the mount data would otherwise not fit in a page. It defaults to
+	// "l" next to MountDir.
+	LinkDir string
 }
 
 func Prepare(spec MountSpec) error {
@@ -22,18 +66,127 @@ func Prepare(spec MountSpec) error {
 			return err
 		}
 	}
-	opts := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s",
-		joinLower(spec.LowerDirs), spec.UpperDir, spec.WorkDir)
-	if err := syscall.Mount("overlay", spec.MountDir, "overlay", 0, opts); err != nil {
+	// the kernel copies at most one page of mount data; longer layer
+	// lists need shorter spellings of the same paths
+	limit := os.Getpagesize() - 1
+	if data := mountData(spec, spec.LowerDirs); len(data) <= limit {
+		return syscall.Mount("overlay", spec.MountDir, "overlay", 0, data)
+	}
+	if dir, rel, ok := relativeLowers(spec.LowerDirs); ok {
+		if data := mountData(spec, rel); len(data) <= limit {
+			return mountFrom(dir, spec.MountDir, data)
+		}
+	}
+	linkDir, rel, err := linkLowers(spec)
+	if err != nil {
 		return err
 	}
-	return nil
+	data := mountData(spec, rel)
+	if len(data) > limit {
+		return fmt.Errorf("overlay: %d layers do not fit in the mount data", len(spec.LowerDirs))
+	}
+	return mountFrom(linkDir, spec.MountDir, data)
+}
+
+// mountData builds the option string for spec using lowers as the
+// spelling of spec.LowerDirs.
+func mountData(spec MountSpec, lowers []string) string {
+	opts := []string{
+		"lowerdir=" + joinLower(lowers),
+		"upperdir=" + spec.UpperDir,
+		"workdir=" + spec.WorkDir,
+	}
+	if spec.Options.Index != Default {
+		opts = append(opts, "index="+spec.Options.Index.String())
+	}
+	if spec.Options.Metacopy != Default {
+		opts = append(opts, "metacopy="+spec.Options.Metacopy.String())
+	}
+	if spec.Options.Volatile {
+		opts = append(opts, "volatile")
+	}
+	if spec.Options.UserXattr {
+		opts = append(opts, "userxattr")
+	}
+	return strings.Join(opts, ",")
 }
 
 func joinLower(dirs []string) string {
 	return strings.Join(dirs, ":")
 }
 
+// relativeLowers rewrites dirs relative to their deepest common parent.
+func relativeLowers(dirs []string) (string, []string, bool) {
+	if len(dirs) == 0 {
+		return "", nil, false
+	}
+	common := filepath.Dir(dirs[0])
+	for _, d := range dirs[1:] {
+		for !strings.HasPrefix(d, common+string(filepath.Separator)) && common != "/" {
+			common = filepath.Dir(common)
+		}
+	}
+	rel := make([]string, len(dirs))
+	for i, d := range dirs {
+		r, err := filepath.Rel(common, d)
+		if err != nil {
+			return "", nil, false
+		}
+		rel[i] = r
+	}
+	return common, rel, true
+}
+
+// linkLowers points numbered symlinks in spec's link directory at each
+// layer and returns the directory and the link names.
+func linkLowers(spec MountSpec) (string, []string, error) {
+	dir := spec.LinkDir
+	if dir == "" {
+		dir = filepath.Join(filepath.Dir(spec.MountDir), "l")
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return "", nil, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", nil, err
+	}
+	names := make([]string, len(spec.LowerDirs))
+	for i, d := range spec.LowerDirs {
+		names[i] = strconv.FormatInt(int64(i), 36)
+		if err := os.Symlink(d, filepath.Join(dir, names[i])); err != nil {
+			return "", nil, err
+		}
+	}
+	return dir, names, nil
+}
+
+// mountFrom mounts overlayfs with relative layer paths resolved against
+// dir. The working directory is per process, so the mount is done on a
+// throwaway thread that has its own copy of it.
+func mountFrom(dir, target, data string) error {
+	// relative paths would otherwise be resolved against dir as well
+	target, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+	errc := make(chan error, 1)
+	go func() {
+		// never unlocked, so the thread exits with the goroutine and
+		// its private working directory goes with it
+		runtime.LockOSThread()
+		if err := syscall.Unshare(syscall.CLONE_FS); err != nil {
+			errc <- fmt.Errorf("unshare fs: %w", err)
+			return
+		}
+		if err := syscall.Chdir(dir); err != nil {
+			errc <- err
+			return
+		}
+		errc <- syscall.Mount("overlay", target, "overlay", 0, data)
+	}()
+	return <-errc
+}
+
 func Unmount(mountDir string) error {
 	return syscall.Unmount(mountDir, 0)
 }
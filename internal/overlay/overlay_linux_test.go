@@ -2,7 +2,12 @@
 
 package overlay
 
-import "testing"
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
 
 func TestJoinLowerAlt(t *testing.T) {
 	s := joinLower([]string{"a", "b", "c"})
@@ -17,3 +22,82 @@ func TestUnmountNonMount(t *testing.T) {
 		t.Fatalf("expected error")
 	}
 }
+
+func TestMountDataOptions(t *testing.T) {
+	spec := MountSpec{
+		UpperDir: "/u",
+		WorkDir:  "/w",
+		Options:  Options{Index: Off, Metacopy: On, Volatile: true, UserXattr: true},
+	}
+	got := mountData(spec, []string{"/a", "/b"})
+	want := "lowerdir=/a:/b,upperdir=/u,workdir=/w,index=off,metacopy=on,volatile,userxattr"
+	if got != want {
+		t.Fatalf("mountData = %s, want %s", got, want)
+	}
+	spec.Options = Options{}
+	if got := mountData(spec, []string{"/a"}); got != "lowerdir=/a,upperdir=/u,workdir=/w" {
+		t.Fatalf("default options should not be spelled out: %s", got)
+	}
+}
+
+func TestRelativeLowers(t *testing.T) {
+	dir, rel, ok := relativeLowers([]string{"/data/layers/sha256/aa", "/data/layers/sha256/bb", "/data/layers/other/cc"})
+	if !ok || dir != "/data/layers" {
+		t.Fatalf("common dir = %s, %v", dir, ok)
+	}
+	if joinLower(rel) != "sha256/aa:sha256/bb:other/cc" {
+		t.Fatalf("relative lowers = %v", rel)
+	}
+}
+
+func TestPrepareManyLayers(t *testing.T) {
+	// with 4 KiB pages 50 layers fit once spelled relative to their
+	// parent and 120 need the symlink directory
+	for _, n := range []int{50, 120} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) { prepareLayers(t, n) })
+	}
+}
+
+func prepareLayers(t *testing.T, n int) {
+	tmp := t.TempDir()
+	var lowers []string
+	for i := 0; i < n; i++ {
+		d := filepath.Join(tmp, "store", fmt.Sprintf("%064d", i))
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(d, fmt.Sprintf("f%d", i)), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		lowers = append(lowers, d)
+	}
+	spec := MountSpec{
+		LowerDirs: lowers,
+		UpperDir:  filepath.Join(tmp, "upper"),
+		WorkDir:   filepath.Join(tmp, "work"),
+		MountDir:  filepath.Join(tmp, "mount"),
+	}
+	if len(mountData(spec, lowers)) < os.Getpagesize() {
+		t.Fatalf("test setup: mount data should exceed a page")
+	}
+	if err := Prepare(spec); err != nil {
+		t.Skipf("mount error (expected in some environments): %v", err)
+	}
+	defer Unmount(spec.MountDir)
+	for _, name := range []string{"f0", fmt.Sprintf("f%d", n-1)} {
+		if _, err := os.Stat(filepath.Join(spec.MountDir, name)); err != nil {
+			t.Fatalf("layer file missing: %v", err)
+		}
+	}
+	// the symlink directory is the fallback for when even the relative
+	// spelling does not fit in a page
+	_, rel, _ := relativeLowers(lowers)
+	wantLinks := len(mountData(spec, rel)) > os.Getpagesize()-1
+	_, err := os.Stat(filepath.Join(tmp, "l"))
+	if usedLinks := err == nil; usedLinks != wantLinks {
+		t.Fatalf("%d layers: symlink dir used = %v, want %v", n, usedLinks, wantLinks)
+	}
+	if wd, _ := os.Getwd(); wd == filepath.Join(tmp, "store") {
+		t.Fatalf("working directory leaked from the mount thread")
+	}
+}
@@ -21,8 +21,12 @@ func ContainersRoot() string {
 	return filepath.Join(DataRoot(), "containers")
 }
 
+func VolumesRoot() string {
+	return filepath.Join(DataRoot(), "volumes")
+}
+
 func EnsureDirs() error {
-	dirs := []string{DataRoot(), ImagesRoot(), ContainersRoot()}
+	dirs := []string{DataRoot(), ImagesRoot(), ContainersRoot(), VolumesRoot()}
 	for _, d := range dirs {
 		if err := os.MkdirAll(d, 0o755); err != nil {
 			return err
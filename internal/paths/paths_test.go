@@ -21,6 +21,9 @@ func TestEnsureDirs(t *testing.T) {
 	if _, err := os.Stat(ContainersRoot()); err != nil {
 		t.Fatalf("containers root missing: %v", err)
 	}
+	if _, err := os.Stat(VolumesRoot()); err != nil {
+		t.Fatalf("volumes root missing: %v", err)
+	}
 	if !filepath.IsAbs(DataRoot()) {
 		t.Fatalf("data root not abs: %s", DataRoot())
 	}
@@ -0,0 +1,34 @@
+package paths
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecureJoinStaysInRoot(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "real", "dir"), 0o755)
+	os.Symlink("/real", filepath.Join(root, "abs"))
+	os.Symlink("../../../..", filepath.Join(root, "real", "up"))
+	os.Symlink("loop", filepath.Join(root, "loop"))
+	cases := map[string]string{
+		"/real/dir":        "real/dir",
+		"/abs/dir":         "real/dir",
+		"/real/up/etc":     "etc",
+		"/../../etc":       "etc",
+		"/abs/missing/new": "real/missing/new",
+	}
+	for in, want := range cases {
+		got, err := SecureJoin(root, in)
+		if err != nil {
+			t.Fatalf("%s: %v", in, err)
+		}
+		if got != filepath.Join(root, want) {
+			t.Fatalf("%s resolved to %s, want %s", in, got, filepath.Join(root, want))
+		}
+	}
+	if _, err := SecureJoin(root, "/loop/x"); err == nil {
+		t.Fatalf("symlink loop should fail")
+	}
+}
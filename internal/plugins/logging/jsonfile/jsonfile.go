@@ -0,0 +1,74 @@
+package jsonfile
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"example.com/containeredu/internal/logs"
+	"example.com/containeredu/internal/plugins/logging"
+)
+
+// Driver writes JSON lines to containers/<id>/container.log, rotating
+// according to the max-size and max-file options.
+type Driver struct{}
+
+func (Driver) Name() string { return "json-file" }
+
+func (Driver) New(containerID string, opts map[string]string) (logging.Logger, error) {
+	rot := logs.Rotation{MaxFiles: 1}
+	for k, v := range opts {
+		switch k {
+		case "max-size":
+			n, err := ParseSize(v)
+			if err != nil {
+				return nil, fmt.Errorf("json-file: max-size: %w", err)
+			}
+			rot.MaxSize = n
+		case "max-file":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("json-file: max-file must be a positive integer: %q", v)
+			}
+			rot.MaxFiles = n
+		default:
+			return nil, fmt.Errorf("json-file: unknown log option %q", k)
+		}
+	}
+	if rot.MaxFiles > 1 && rot.MaxSize == 0 {
+		return nil, fmt.Errorf("json-file: max-file requires max-size")
+	}
+	return logs.Create(logs.Path(containerID), rot)
+}
+
+func (Driver) Read(containerID string, opts logs.ReadOptions, fn func(logs.Entry) error) error {
+	return logs.Read(logs.Path(containerID), opts, fn)
+}
+
+// ParseSize parses sizes such as 512, 10k, 20m or 1g (powers of 1024).
+func ParseSize(s string) (int64, error) {
+	v := strings.ToLower(strings.TrimSpace(s))
+	mult := int64(1)
+	if v != "" {
+		switch v[len(v)-1] {
+		case 'k':
+			mult = 1 << 10
+		case 'm':
+			mult = 1 << 20
+		case 'g':
+			mult = 1 << 30
+		}
+		if mult > 1 {
+			v = v[:len(v)-1]
+		}
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mult, nil
+}
+
+func init() {
+	logging.Register(Driver{})
+}
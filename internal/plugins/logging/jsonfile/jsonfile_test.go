@@ -0,0 +1,63 @@
+package jsonfile
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"example.com/containeredu/internal/logs"
+	"example.com/containeredu/internal/plugins/logging"
+)
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]int64{"512": 512, "10k": 10 << 10, "20M": 20 << 20, "1g": 1 << 30}
+	for in, want := range cases {
+		got, err := ParseSize(in)
+		if err != nil || got != want {
+			t.Fatalf("ParseSize(%q) = %d, %v", in, got, err)
+		}
+	}
+	for _, bad := range []string{"", "k", "-1", "ten"} {
+		if _, err := ParseSize(bad); err == nil {
+			t.Fatalf("ParseSize(%q) should fail", bad)
+		}
+	}
+}
+
+func TestJSONFileLogsAndRotates(t *testing.T) {
+	tmp := t.TempDir()
+	os.Setenv("HOME", tmp)
+	d := logging.Get("json-file")
+	if d == nil {
+		t.Fatalf("json-file driver not registered")
+	}
+	if _, err := d.New("c1", map[string]string{"max-file": "3"}); err == nil {
+		t.Fatalf("max-file without max-size should fail")
+	}
+	if _, err := d.New("c1", map[string]string{"bogus": "1"}); err == nil {
+		t.Fatalf("unknown option should fail")
+	}
+	l, err := d.New("c1", map[string]string{"max-size": "1k", "max-file": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := l.Log(logs.Entry{Log: "some output line\n", Stream: "stdout", Time: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Close()
+	if _, err := os.Stat(logs.Path("c1") + ".1"); err != nil {
+		t.Fatalf("log was not rotated: %v", err)
+	}
+	var n int
+	if err := d.(logging.Reader).Read("c1", logs.ReadOptions{Tail: -1}, func(logs.Entry) error {
+		n++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 || n >= 100 {
+		t.Fatalf("expected rotation to drop old lines, read %d", n)
+	}
+}
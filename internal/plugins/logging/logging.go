@@ -0,0 +1,44 @@
+package logging
+
+import (
+	"sync"
+
+	"example.com/containeredu/internal/logs"
+)
+
+// Logger receives the output of one container.
+type Logger interface {
+	Log(e logs.Entry) error
+	Close() error
+}
+
+type Driver interface {
+	Name() string
+	// New validates opts (the --log-opt key/value pairs) and returns a
+	// logger for the container.
+	New(containerID string, opts map[string]string) (Logger, error)
+}
+
+// Reader is implemented by drivers whose output `cede logs` can read back.
+type Reader interface {
+	Read(containerID string, opts logs.ReadOptions, fn func(logs.Entry) error) error
+}
+
+const DefaultDriver = "json-file"
+
+var (
+	mu       sync.RWMutex
+	registry = map[string]Driver{}
+)
+
+func Register(d Driver) {
+	mu.Lock()
+	registry[d.Name()] = d
+	mu.Unlock()
+}
+
+func Get(name string) Driver {
+	mu.RLock()
+	defer mu.RUnlock()
+	return registry[name]
+}
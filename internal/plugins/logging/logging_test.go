@@ -0,0 +1,21 @@
+package logging
+
+import "testing"
+
+type ldriver struct{}
+
+func (ldriver) Name() string { return "l" }
+func (ldriver) New(containerID string, opts map[string]string) (Logger, error) {
+	return nil, nil
+}
+
+func TestRegistry(t *testing.T) {
+	Register(ldriver{})
+	d := Get("l")
+	if d == nil || d.Name() != "l" {
+		t.Fatalf("bad registry")
+	}
+	if _, ok := d.(Reader); ok {
+		t.Fatalf("driver without Read should not be a Reader")
+	}
+}
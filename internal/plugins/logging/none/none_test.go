@@ -0,0 +1,25 @@
+package none
+
+import (
+	"testing"
+
+	"example.com/containeredu/internal/logs"
+	"example.com/containeredu/internal/plugins/logging"
+)
+
+func TestNoneDiscards(t *testing.T) {
+	d := logging.Get("none")
+	if d == nil {
+		t.Fatalf("none driver not registered")
+	}
+	l, err := d.New("c", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Log(logs.Entry{Log: "x\n"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.New("c", map[string]string{"max-size": "1k"}); err == nil {
+		t.Fatalf("expected error for unsupported option")
+	}
+}
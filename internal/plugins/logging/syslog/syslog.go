@@ -0,0 +1,114 @@
+package syslog
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/containeredu/internal/logs"
+	"example.com/containeredu/internal/plugins/logging"
+)
+
+const defaultAddress = "unix:///dev/log"
+
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+const (
+	severityErr  = 3
+	severityInfo = 6
+)
+
+// Driver sends each line to the local syslog daemon over its unix socket.
+// stdout lines are logged at info and stderr lines at err severity.
+type Driver struct{}
+
+func (Driver) Name() string { return "syslog" }
+
+func (Driver) New(containerID string, opts map[string]string) (logging.Logger, error) {
+	address := defaultAddress
+	facility := facilities["daemon"]
+	tag := containerID
+	if len(tag) > 12 {
+		tag = tag[:12]
+	}
+	for k, v := range opts {
+		switch k {
+		case "syslog-address":
+			address = v
+		case "syslog-facility":
+			f, ok := facilities[v]
+			if !ok {
+				return nil, fmt.Errorf("syslog: unknown facility %q", v)
+			}
+			facility = f
+		case "tag":
+			tag = v
+		default:
+			return nil, fmt.Errorf("syslog: unknown log option %q", k)
+		}
+	}
+	conn, err := dial(address)
+	if err != nil {
+		return nil, fmt.Errorf("syslog: %w", err)
+	}
+	hostname, _ := os.Hostname()
+	return &logger{conn: conn, facility: facility, tag: tag, hostname: hostname}, nil
+}
+
+// dial connects to a unix:// (datagram, falling back to stream) or
+// unixgram:// socket path.
+func dial(address string) (net.Conn, error) {
+	switch {
+	case strings.HasPrefix(address, "unixgram://"):
+		return net.Dial("unixgram", strings.TrimPrefix(address, "unixgram://"))
+	case strings.HasPrefix(address, "unix://"):
+		p := strings.TrimPrefix(address, "unix://")
+		if c, err := net.Dial("unixgram", p); err == nil {
+			return c, nil
+		}
+		return net.Dial("unix", p)
+	default:
+		return nil, fmt.Errorf("unsupported syslog-address %q (only local sockets)", address)
+	}
+}
+
+type logger struct {
+	mu       sync.Mutex
+	conn     net.Conn
+	facility int
+	tag      string
+	hostname string
+}
+
+func (l *logger) Log(e logs.Entry) error {
+	severity := severityInfo
+	if e.Stream == "stderr" {
+		severity = severityErr
+	}
+	msg := format(l.facility*8+severity, e.Time, l.hostname, l.tag, os.Getpid(), strings.TrimRight(e.Log, "\n"))
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := l.conn.Write([]byte(msg))
+	return err
+}
+
+func (l *logger) Close() error {
+	return l.conn.Close()
+}
+
+// format renders an RFC 3164 message, the format local syslog daemons expect.
+func format(pri int, t time.Time, hostname, tag string, pid int, msg string) string {
+	return fmt.Sprintf("<%d>%s %s %s[%d]: %s\n", pri, t.Local().Format(time.Stamp), hostname, tag, pid, msg)
+}
+
+func init() {
+	logging.Register(Driver{})
+}
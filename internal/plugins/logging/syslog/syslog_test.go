@@ -0,0 +1,58 @@
+package syslog
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/containeredu/internal/logs"
+	"example.com/containeredu/internal/plugins/logging"
+)
+
+func TestFormat(t *testing.T) {
+	ts := time.Date(2024, 3, 7, 9, 5, 1, 0, time.Local)
+	got := format(30, ts, "host", "abc", 42, "hello")
+	if got != "<30>Mar  7 09:05:01 host abc[42]: hello\n" {
+		t.Fatalf("unexpected message: %q", got)
+	}
+}
+
+func TestSyslogSendsToSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "log.sock")
+	pc, err := net.ListenPacket("unixgram", sock)
+	if err != nil {
+		t.Skipf("unixgram unavailable: %v", err)
+	}
+	defer pc.Close()
+	d := logging.Get("syslog")
+	if d == nil {
+		t.Fatalf("syslog driver not registered")
+	}
+	if _, err := d.New("c", map[string]string{"syslog-address": "tcp://1.2.3.4:514"}); err == nil {
+		t.Fatalf("remote address should be rejected")
+	}
+	if _, err := d.New("c", map[string]string{"syslog-address": "unix://" + sock, "syslog-facility": "nope"}); err == nil {
+		t.Fatalf("unknown facility should be rejected")
+	}
+	l, err := d.New("0123456789abcdef", map[string]string{"syslog-address": "unix://" + sock, "syslog-facility": "local0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := l.Log(logs.Entry{Log: "oops\n", Stream: "stderr", Time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 512)
+	pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buf[:n])
+	// local0 (16) * 8 + err (3)
+	if !strings.HasPrefix(msg, "<131>") || !strings.Contains(msg, " 0123456789ab[") || !strings.HasSuffix(msg, ": oops\n") {
+		t.Fatalf("unexpected syslog message: %q", msg)
+	}
+}
@@ -34,12 +34,7 @@ func (p Plugin) Setup(containerID string, pid int) (string, error) {
 			return "", fmt.Errorf("bridge up: %w", err)
 		}
 	}
-	short := containerID
-	if len(short) > 8 {
-		short = short[:8]
-	}
-	hostV := "veth-" + short + "-h"
-	ctV := "veth-" + short + "-c"
+	hostV, ctV := vethNames(containerID)
 	// create veth pair
 	if err := runner("ip", "link", "add", hostV, "type", "veth", "peer", "name", ctV); err != nil {
 		return "", fmt.Errorf("veth add: %w", err)
@@ -72,6 +67,27 @@ func (p Plugin) Setup(containerID string, pid int) (string, error) {
 	return ip, nil
 }
 
+// Teardown deletes the host end of the veth pair, which also removes the
+// peer if the container's network namespace still exists.
+func (p Plugin) Teardown(containerID string) error {
+	hostV, _ := vethNames(containerID)
+	if runner("ip", "link", "show", hostV) != nil {
+		return nil
+	}
+	if err := runner("ip", "link", "del", hostV); err != nil {
+		return fmt.Errorf("veth del: %w", err)
+	}
+	return nil
+}
+
+func vethNames(containerID string) (string, string) {
+	short := containerID
+	if len(short) > 8 {
+		short = short[:8]
+	}
+	return "veth-" + short + "-h", "veth-" + short + "-c"
+}
+
 func run(cmd string, args ...string) error {
 	return runner(cmd, args...)
 }
@@ -3,6 +3,8 @@
 package bridge
 
 import (
+	"fmt"
+	"strings"
 	"sync"
 	"testing"
 )
@@ -30,3 +32,31 @@ func TestSetupRunsCommandsAndReturnsIP(t *testing.T) {
 	}
 }
 
+func TestTeardownDeletesHostVeth(t *testing.T) {
+	oldRunner := runner
+	defer func() { runner = oldRunner }()
+	var calls []string
+	exists := true
+	runner = func(cmd string, args ...string) error {
+		calls = append(calls, cmd+" "+strings.Join(args, " "))
+		if len(args) > 1 && args[1] == "show" && !exists {
+			return fmt.Errorf("not found")
+		}
+		return nil
+	}
+	p := Plugin{name: "bridge0", bridge: "cede0"}
+	if err := p.Teardown("abcdef012345"); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 2 || calls[1] != "ip link del veth-abcdef01-h" {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+	calls = nil
+	exists = false
+	if err := p.Teardown("abcdef012345"); err != nil {
+		t.Fatalf("teardown of missing veth should succeed: %v", err)
+	}
+	if len(calls) != 1 {
+		t.Fatalf("missing veth should not be deleted: %v", calls)
+	}
+}
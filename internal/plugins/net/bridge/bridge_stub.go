@@ -10,6 +10,7 @@ type Plugin struct{}
 
 func (Plugin) Name() string                                      { return "bridge0" }
 func (Plugin) Setup(containerID string, pid int) (string, error) { return "", nil }
+func (Plugin) Teardown(containerID string) error                 { return nil }
 
 func init() {
 	nreg.Register(Plugin{})
@@ -5,6 +5,9 @@ import "sync"
 type NetPlugin interface {
 	Name() string
 	Setup(containerID string, pid int) (string, error)
+	// Teardown removes what Setup created on the host. It must succeed when
+	// Setup never ran or the resources are already gone.
+	Teardown(containerID string) error
 }
 
 var (
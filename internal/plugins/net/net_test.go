@@ -6,6 +6,7 @@ type dummy struct{}
 
 func (d dummy) Name() string                                      { return "d" }
 func (d dummy) Setup(containerID string, pid int) (string, error) { return "10.0.0.2", nil }
+func (d dummy) Teardown(containerID string) error                 { return nil }
 
 func TestRegistry(t *testing.T) {
 	Register(dummy{})
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package storage
+
+import "os"
+
+func inode(fi os.FileInfo) (uint64, bool) {
+	return 0, false
+}
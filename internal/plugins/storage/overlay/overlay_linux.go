@@ -0,0 +1,216 @@
+//go:build linux
+
+// Package overlay is the overlayfs storage driver: image layers are the
+// read-only lowerdirs and each container gets its own upper and work dir.
+package overlay
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	ovl "example.com/containeredu/internal/overlay"
+	"example.com/containeredu/internal/paths"
+	sreg "example.com/containeredu/internal/plugins/storage"
+)
+
+const Name = "overlay"
+
+type Driver struct{}
+
+func (Driver) Name() string { return Name }
+
+func dir(containerID string) string {
+	return filepath.Join(paths.ContainersRoot(), containerID)
+}
+
+func spec(containerID string) ovl.MountSpec {
+	d := dir(containerID)
+	return ovl.MountSpec{
+		UpperDir: filepath.Join(d, "upper"),
+		WorkDir:  filepath.Join(d, "work"),
+		MountDir: filepath.Join(d, "rootfs"),
+		LinkDir:  filepath.Join(d, "l"),
+	}
+}
+
+// parseOptions reads the overlay.* entries of the storage configuration:
+// overlay.index and overlay.metacopy take on/off, overlay.volatile and
+// overlay.userxattr take a boolean.
+func parseOptions(opts map[string]string) (ovl.Options, error) {
+	var o ovl.Options
+	for k, v := range opts {
+		name, ok := strings.CutPrefix(k, Name+".")
+		if !ok {
+			continue
+		}
+		var err error
+		switch name {
+		case "index":
+			o.Index, err = parseSwitch(v)
+		case "metacopy":
+			o.Metacopy, err = parseSwitch(v)
+		case "volatile":
+			o.Volatile, err = strconv.ParseBool(v)
+		case "userxattr":
+			o.UserXattr, err = strconv.ParseBool(v)
+		default:
+			return o, fmt.Errorf("overlay: unknown option %q", k)
+		}
+		if err != nil {
+			return o, fmt.Errorf("overlay: option %s: %w", k, err)
+		}
+	}
+	return o, nil
+}
+
+func parseSwitch(v string) (ovl.Switch, error) {
+	switch v {
+	case "on":
+		return ovl.On, nil
+	case "off":
+		return ovl.Off, nil
+	case "", "default":
+		return ovl.Default, nil
+	}
+	return ovl.Default, fmt.Errorf("want on or off, got %q", v)
+}
+
+// lowerFile records the layers passed to Create for later mounts.
+func lowerFile(containerID string) string {
+	return filepath.Join(dir(containerID), "lower.json")
+}
+
+// whiteoutPrefix marks a tar-style whiteout. Layers unpacked without the
+// privilege to make 0/0 devices keep them, and overlayfs would show them
+// as plain files rather than hide what they name.
+const whiteoutPrefix = ".wh."
+
+// overlayfs reads the trusted opaque xattr, or the user namespace one
+// instead when mounted with userxattr.
+const (
+	trustedOpaque = "trusted.overlay.opaque"
+	userOpaque    = "user.overlay.opaque"
+)
+
+// checkLowers rejects layers overlayfs cannot stack correctly and reports
+// whether they need userxattr: layers unpacked without CAP_SYS_ADMIN mark
+// opaque directories with the user namespace xattr. A mount reads only one
+// of the two, so layers using both are rejected too.
+func checkLowers(layers []string) (userXattr bool, err error) {
+	var trusted bool
+	for _, l := range layers {
+		err := filepath.WalkDir(l, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if p != l && strings.HasPrefix(d.Name(), whiteoutPrefix) {
+				return fmt.Errorf("overlay: layer %s has tar-style whiteout %s", l, p)
+			}
+			if d.IsDir() {
+				trusted = trusted || isOpaque(p, trustedOpaque)
+				userXattr = userXattr || isOpaque(p, userOpaque)
+			}
+			return nil
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+	if trusted && userXattr {
+		return false, fmt.Errorf("overlay: layers mark opaque directories with both %s and %s", trustedOpaque, userOpaque)
+	}
+	return userXattr, nil
+}
+
+func isOpaque(dir, xattr string) bool {
+	buf := make([]byte, 1)
+	n, err := syscall.Getxattr(dir, xattr, buf)
+	return err == nil && n == 1 && buf[0] == 'y'
+}
+
+// userXattrFile exists when the container's layers need userxattr.
+func userXattrFile(containerID string) string {
+	return filepath.Join(dir(containerID), "userxattr")
+}
+
+func (Driver) Create(containerID string, layers []string) error {
+	if len(layers) == 0 {
+		return fmt.Errorf("overlay: image has no layers")
+	}
+	if _, err := parseOptions(sreg.LoadConfig().Options); err != nil {
+		return err
+	}
+	userXattr, err := checkLowers(layers)
+	if err != nil {
+		return err
+	}
+	s := spec(containerID)
+	for _, d := range []string{s.UpperDir, s.WorkDir, s.MountDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			return err
+		}
+	}
+	if userXattr {
+		if err := os.WriteFile(userXattrFile(containerID), nil, 0o644); err != nil {
+			return err
+		}
+	}
+	b, _ := json.Marshal(layers)
+	return os.WriteFile(lowerFile(containerID), b, 0o644)
+}
+
+func (Driver) Mount(containerID string) (string, error) {
+	b, err := os.ReadFile(lowerFile(containerID))
+	if err != nil {
+		return "", fmt.Errorf("overlay: %w", err)
+	}
+	s := spec(containerID)
+	if err := json.Unmarshal(b, &s.LowerDirs); err != nil {
+		return "", fmt.Errorf("overlay: %w", err)
+	}
+	if s.Options, err = parseOptions(sreg.LoadConfig().Options); err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(userXattrFile(containerID)); err == nil {
+		s.Options.UserXattr = true
+	}
+	if err := ovl.Prepare(s); err != nil {
+		return "", fmt.Errorf("overlay mount: %w", err)
+	}
+	return s.MountDir, nil
+}
+
+func (Driver) Unmount(containerID string) error {
+	err := ovl.Unmount(spec(containerID).MountDir)
+	if err != nil && err != syscall.EINVAL && err != syscall.ENOENT {
+		return fmt.Errorf("unmount rootfs: %w", err)
+	}
+	return nil
+}
+
+func (d Driver) Remove(containerID string) error {
+	if err := d.Unmount(containerID); err != nil {
+		return err
+	}
+	s := spec(containerID)
+	for _, p := range []string{s.MountDir, s.UpperDir, s.WorkDir, s.LinkDir, lowerFile(containerID), userXattrFile(containerID)} {
+		if err := os.RemoveAll(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (Driver) Size(containerID string) (int64, error) {
+	return sreg.DirSize(spec(containerID).UpperDir)
+}
+
+func init() {
+	sreg.Register(Driver{})
+}
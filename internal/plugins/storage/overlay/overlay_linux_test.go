@@ -0,0 +1,129 @@
+//go:build linux
+
+package overlay
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	ovl "example.com/containeredu/internal/overlay"
+	sreg "example.com/containeredu/internal/plugins/storage"
+)
+
+func TestRegistered(t *testing.T) {
+	if d := sreg.Get(Name); d == nil {
+		t.Fatalf("overlay driver not registered")
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	tmp := t.TempDir()
+	os.Setenv("HOME", tmp)
+	lower := filepath.Join(tmp, "layer")
+	if err := os.MkdirAll(lower, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(lower, "f"), []byte("base"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	d := Driver{}
+	if err := d.Create("c1", nil); err == nil {
+		t.Fatalf("create without layers should fail")
+	}
+	if err := d.Create("c1", []string{lower}); err != nil {
+		t.Fatal(err)
+	}
+	root, err := d.Mount("c1")
+	if err != nil {
+		t.Logf("mount error (expected in some environments): %v", err)
+	} else {
+		if b, err := os.ReadFile(filepath.Join(root, "f")); err != nil || string(b) != "base" {
+			t.Fatalf("layer not visible: %q %v", b, err)
+		}
+		if err := os.WriteFile(filepath.Join(root, "new"), make([]byte, 10), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := d.Size("c1"); err != nil || n != 10 {
+			t.Fatalf("size = %d, %v", n, err)
+		}
+		if err := d.Unmount("c1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Unmount("c1"); err != nil {
+		t.Fatalf("unmounting twice should succeed: %v", err)
+	}
+	if err := d.Remove("c1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, ".local", "share", "cede", "containers", "c1", "upper")); !os.IsNotExist(err) {
+		t.Fatalf("upper dir left behind: %v", err)
+	}
+	if err := d.Remove("c1"); err != nil {
+		t.Fatalf("removing twice should succeed: %v", err)
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	o, err := parseOptions(map[string]string{
+		"overlay.index":     "off",
+		"overlay.metacopy":  "on",
+		"overlay.volatile":  "true",
+		"overlay.userxattr": "1",
+		"vfs.other":         "ignored",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ovl.Options{Index: ovl.Off, Metacopy: ovl.On, Volatile: true, UserXattr: true}
+	if o != want {
+		t.Fatalf("options = %+v, want %+v", o, want)
+	}
+	for k, v := range map[string]string{"overlay.index": "maybe", "overlay.bogus": "1", "overlay.volatile": "x"} {
+		if _, err := parseOptions(map[string]string{k: v}); err == nil {
+			t.Fatalf("%s=%s should be rejected", k, v)
+		}
+	}
+}
+
+func TestCreateRejectsTarWhiteouts(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	lower := filepath.Join(tmp, "layer")
+	if err := os.MkdirAll(filepath.Join(lower, "etc"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(lower, "etc", ".wh.passwd"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := (Driver{}).Create("c1", []string{lower}); err == nil {
+		t.Fatalf("create should refuse a layer with .wh. files")
+	}
+}
+
+func TestCheckLowersOpaqueXattrs(t *testing.T) {
+	tmp := t.TempDir()
+	user, trusted := filepath.Join(tmp, "user"), filepath.Join(tmp, "trusted")
+	for _, l := range []string{user, trusted} {
+		if err := os.MkdirAll(filepath.Join(l, "var"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := syscall.Setxattr(filepath.Join(user, "var"), userOpaque, []byte("y"), 0); err != nil {
+		t.Skipf("no user xattrs: %v", err)
+	}
+	if got, err := checkLowers([]string{user}); err != nil || !got {
+		t.Fatalf("checkLowers = %v, %v; want userxattr", got, err)
+	}
+	if got, err := checkLowers([]string{trusted}); err != nil || got {
+		t.Fatalf("checkLowers = %v, %v; want no userxattr", got, err)
+	}
+	if err := syscall.Setxattr(filepath.Join(trusted, "var"), trustedOpaque, []byte("y"), 0); err != nil {
+		t.Skipf("no trusted xattrs: %v", err)
+	}
+	if _, err := checkLowers([]string{user, trusted}); err == nil {
+		t.Fatalf("layers mixing both opaque xattrs should be rejected")
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+package overlay
+
+import (
+	"fmt"
+
+	sreg "example.com/containeredu/internal/plugins/storage"
+)
+
+const Name = "overlay"
+
+type Driver struct{}
+
+var errUnsupported = fmt.Errorf("overlay: only supported on linux")
+
+func (Driver) Name() string                                     { return Name }
+func (Driver) Create(containerID string, layers []string) error { return errUnsupported }
+func (Driver) Mount(containerID string) (string, error)         { return "", errUnsupported }
+func (Driver) Unmount(containerID string) error                 { return nil }
+func (Driver) Remove(containerID string) error                  { return nil }
+func (Driver) Size(containerID string) (int64, error)           { return 0, errUnsupported }
+
+func init() {
+	sreg.Register(Driver{})
+}
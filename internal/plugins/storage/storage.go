@@ -1,11 +1,41 @@
 package storage
 
-import "sync"
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
 
+	"example.com/containeredu/internal/paths"
+)
+
+// Driver builds container root filesystems out of image layers. Drivers
+// keep their files under the container's directory in
+// paths.ContainersRoot(); every method is keyed by container ID.
 type Driver interface {
 	Name() string
+	// Create prepares an unmounted filesystem for the container. layers
+	// are the image's layer directories, top-most first, the order
+	// overlayfs expects for lowerdir.
+	Create(containerID string, layers []string) error
+	// Mount makes the filesystem available and returns the path of its
+	// root.
+	Mount(containerID string) (string, error)
+	// Unmount undoes Mount. It succeeds if the filesystem is not mounted.
+	Unmount(containerID string) error
+	// Remove unmounts and deletes everything Create made. It succeeds if
+	// nothing is left to remove.
+	Remove(containerID string) error
+	// Size returns the bytes the container has written on top of its
+	// image.
+	Size(containerID string) (int64, error)
 }
 
+// DefaultDriver is used when neither --storage-driver nor the data root's
+// storage.json names a driver.
+const DefaultDriver = "overlay"
+
 var (
 	mu       sync.RWMutex
 	registry = map[string]Driver{}
@@ -22,3 +52,67 @@ func Get(name string) Driver {
 	defer mu.RUnlock()
 	return registry[name]
 }
+
+// Config is the data root's storage configuration, e.g.
+// {"driver": "overlay", "options": {"overlay.index": "off"}}. Option keys
+// are prefixed with the name of the driver they are meant for.
+type Config struct {
+	Driver  string            `json:"driver"`
+	Options map[string]string `json:"options,omitempty"`
+}
+
+func ConfigPath() string {
+	return filepath.Join(paths.DataRoot(), "storage.json")
+}
+
+// LoadConfig reads ConfigPath. A missing or unreadable file gives the zero
+// Config.
+func LoadConfig() Config {
+	var cfg Config
+	b, err := os.ReadFile(ConfigPath())
+	if err != nil {
+		return cfg
+	}
+	_ = json.Unmarshal(b, &cfg)
+	return cfg
+}
+
+// ConfiguredDriver returns the driver named in ConfigPath, or DefaultDriver
+// if there is none.
+func ConfiguredDriver() string {
+	if d := LoadConfig().Driver; d != "" {
+		return d
+	}
+	return DefaultDriver
+}
+
+// DirSize sums the sizes of the regular files below root, counting hard
+// linked files once. A missing root has size 0.
+func DirSize(root string) (int64, error) {
+	var total int64
+	seen := map[uint64]bool{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == root {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if ino, ok := inode(fi); ok {
+			if seen[ino] {
+				return nil
+			}
+			seen[ino] = true
+		}
+		total += fi.Size()
+		return nil
+	})
+	return total, err
+}
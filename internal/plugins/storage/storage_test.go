@@ -1,10 +1,19 @@
 package storage
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
 
 type sdriver struct{}
 
-func (s sdriver) Name() string { return "s" }
+func (s sdriver) Name() string                            { return "s" }
+func (s sdriver) Create(id string, layers []string) error { return nil }
+func (s sdriver) Mount(id string) (string, error)         { return "", nil }
+func (s sdriver) Unmount(id string) error                 { return nil }
+func (s sdriver) Remove(id string) error                  { return nil }
+func (s sdriver) Size(id string) (int64, error)           { return 0, nil }
 
 func TestRegistry(t *testing.T) {
 	Register(sdriver{})
@@ -13,3 +22,41 @@ func TestRegistry(t *testing.T) {
 		t.Fatalf("bad registry")
 	}
 }
+
+func TestConfiguredDriver(t *testing.T) {
+	os.Setenv("HOME", t.TempDir())
+	if got := ConfiguredDriver(); got != DefaultDriver {
+		t.Fatalf("default = %s", got)
+	}
+	if err := os.MkdirAll(filepath.Dir(ConfigPath()), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(ConfigPath(), []byte(`{"driver":"vfs","options":{"vfs.x":"1"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := ConfiguredDriver(); got != "vfs" {
+		t.Fatalf("configured = %s", got)
+	}
+	if got := LoadConfig().Options["vfs.x"]; got != "1" {
+		t.Fatalf("options not loaded: %q", got)
+	}
+}
+
+func TestDirSize(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "d"), 0o755)
+	os.WriteFile(filepath.Join(root, "a"), make([]byte, 100), 0o644)
+	os.WriteFile(filepath.Join(root, "d", "b"), make([]byte, 20), 0o644)
+	os.Link(filepath.Join(root, "a"), filepath.Join(root, "d", "a-link"))
+	os.Symlink("a", filepath.Join(root, "s"))
+	n, err := DirSize(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 120 {
+		t.Fatalf("size = %d, want 120", n)
+	}
+	if n, err := DirSize(filepath.Join(root, "missing")); err != nil || n != 0 {
+		t.Fatalf("missing dir: %d %v", n, err)
+	}
+}
@@ -0,0 +1,278 @@
+//go:build linux
+
+package vfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	opaqueMarker   = ".wh..wh..opq"
+)
+
+// overlayfs marks an opaque directory with one of these xattrs, the user
+// namespace one when mounted with userxattr.
+var opaqueXattrs = []string{"trusted.overlay.opaque", "user.overlay.opaque"}
+
+type fileID struct {
+	dev, ino uint64
+}
+
+type dirTimes struct {
+	path         string
+	atime, mtime time.Time
+}
+
+// copier applies one layer. Layers may use tar-style whiteouts (.wh.name
+// files and .wh..wh..opq markers) or overlayfs ones (0/0 character devices
+// and the opaque xattr); both delete from the layers below.
+type copier struct {
+	links map[fileID]string
+	dirs  []dirTimes
+}
+
+func applyLayer(dst, layer string) error {
+	c := &copier{links: map[fileID]string{}}
+	if err := c.copyDir(layer, dst); err != nil {
+		return err
+	}
+	// filling a directory changes its mtime, so restore the layer's times
+	// last and deepest first
+	for i := len(c.dirs) - 1; i >= 0; i-- {
+		d := c.dirs[i]
+		if err := os.Chtimes(d.path, d.atime, d.mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *copier) copyDir(src, dst string) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	if isOpaque(src, entries) {
+		if err := clearDir(dst); err != nil {
+			return err
+		}
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if name == opaqueMarker {
+			continue
+		}
+		if strings.HasPrefix(name, whiteoutPrefix) {
+			if err := os.RemoveAll(filepath.Join(dst, strings.TrimPrefix(name, whiteoutPrefix))); err != nil {
+				return err
+			}
+			continue
+		}
+		s, d := filepath.Join(src, name), filepath.Join(dst, name)
+		fi, err := os.Lstat(s)
+		if err != nil {
+			return err
+		}
+		if isWhiteoutDevice(fi) {
+			if err := os.RemoveAll(d); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := c.copyEntry(s, d, fi); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *copier) copyEntry(src, dst string, fi os.FileInfo) error {
+	st := fi.Sys().(*syscall.Stat_t)
+	// an entry replaces whatever the lower layers had there, except that
+	// directories merge
+	if old, err := os.Lstat(dst); err == nil && !(fi.IsDir() && old.IsDir()) {
+		if err := os.RemoveAll(dst); err != nil {
+			return err
+		}
+	}
+	mode := fi.Mode()
+	switch {
+	case mode.IsDir():
+		if err := os.Mkdir(dst, 0o700); err != nil && !os.IsExist(err) {
+			return err
+		}
+		if err := c.copyDir(src, dst); err != nil {
+			return err
+		}
+	case mode&os.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(target, dst); err != nil {
+			return err
+		}
+		return ignorePerm(os.Lchown(dst, int(st.Uid), int(st.Gid)))
+	case mode.IsRegular():
+		if st.Nlink > 1 {
+			id := fileID{uint64(st.Dev), uint64(st.Ino)}
+			if first, ok := c.links[id]; ok {
+				return os.Link(first, dst)
+			}
+			c.links[id] = dst
+		}
+		if err := copyFile(src, dst); err != nil {
+			return err
+		}
+	default:
+		// devices, fifos and sockets; without privileges device nodes
+		// cannot be made and the copy goes on without them
+		if err := syscall.Mknod(dst, st.Mode, int(st.Rdev)); err != nil {
+			return ignorePerm(err)
+		}
+	}
+	if err := ignorePerm(os.Lchown(dst, int(st.Uid), int(st.Gid))); err != nil {
+		return err
+	}
+	// after chown, which clears the setuid and setgid bits
+	if err := syscall.Chmod(dst, st.Mode&0o7777); err != nil {
+		return err
+	}
+	if err := copyXattrs(src, dst); err != nil {
+		return err
+	}
+	atime := time.Unix(st.Atim.Unix())
+	mtime := time.Unix(st.Mtim.Unix())
+	if mode.IsDir() {
+		c.dirs = append(c.dirs, dirTimes{dst, atime, mtime})
+		return nil
+	}
+	return os.Chtimes(dst, atime, mtime)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// copyXattrs copies extended attributes except overlayfs' own. Filesystems
+// or callers that cannot set an attribute are skipped.
+func copyXattrs(src, dst string) error {
+	names, err := listXattrs(src)
+	if err != nil {
+		return ignorePerm(err)
+	}
+	for _, name := range names {
+		if strings.HasPrefix(name, "trusted.overlay.") || strings.HasPrefix(name, "user.overlay.") {
+			continue
+		}
+		val, err := getXattr(src, name)
+		if err != nil {
+			return ignorePerm(err)
+		}
+		if err := ignorePerm(syscall.Setxattr(dst, name, val, 0)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func listXattrs(path string) ([]string, error) {
+	n, err := syscall.Listxattr(path, nil)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	buf := make([]byte, n)
+	n, err = syscall.Listxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, b := range bytes.Split(buf[:n], []byte{0}) {
+		if len(b) > 0 {
+			names = append(names, string(b))
+		}
+	}
+	return names, nil
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	n, err := syscall.Getxattr(path, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, n)
+	n, err = syscall.Getxattr(path, name, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func isOpaque(dir string, entries []os.DirEntry) bool {
+	for _, e := range entries {
+		if e.Name() == opaqueMarker {
+			return true
+		}
+	}
+	for _, name := range opaqueXattrs {
+		if v, err := getXattr(dir, name); err == nil && string(v) == "y" {
+			return true
+		}
+	}
+	return false
+}
+
+func isWhiteoutDevice(fi os.FileInfo) bool {
+	if fi.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	return ok && st.Rdev == 0
+}
+
+// clearDir empties dir, which may not exist yet.
+func clearDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ignorePerm drops errors that only mean an unprivileged caller or a
+// filesystem without xattr support.
+func ignorePerm(err error) error {
+	if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.ENODATA) {
+		return nil
+	}
+	return err
+}
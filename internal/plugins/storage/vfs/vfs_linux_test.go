@@ -0,0 +1,134 @@
+//go:build linux
+
+package vfs
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	sreg "example.com/containeredu/internal/plugins/storage"
+)
+
+func write(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegistered(t *testing.T) {
+	if sreg.Get(Name) == nil {
+		t.Fatalf("vfs driver not registered")
+	}
+}
+
+func TestCreateAppliesLayersAndWhiteouts(t *testing.T) {
+	tmp := t.TempDir()
+	os.Setenv("HOME", tmp)
+	base := filepath.Join(tmp, "base")
+	top := filepath.Join(tmp, "top")
+	write(t, filepath.Join(base, "etc", "keep"), "base")
+	write(t, filepath.Join(base, "etc", "gone"), "base")
+	write(t, filepath.Join(base, "etc", "changed"), "base")
+	write(t, filepath.Join(base, "opaque", "old"), "base")
+	write(t, filepath.Join(base, "dirfile", "x"), "base")
+	write(t, filepath.Join(base, "hl1"), "linked")
+	if err := os.Link(filepath.Join(base, "hl1"), filepath.Join(base, "hl2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("etc/keep", filepath.Join(base, "link")); err != nil {
+		t.Fatal(err)
+	}
+	write(t, filepath.Join(top, "etc", ".wh.gone"), "")
+	write(t, filepath.Join(top, "etc", "changed"), "top")
+	write(t, filepath.Join(top, "opaque", ".wh..wh..opq"), "")
+	write(t, filepath.Join(top, "opaque", "new"), "top")
+	write(t, filepath.Join(top, "dirfile"), "now a file")
+	old := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(top, "etc"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	d := Driver{}
+	if err := d.Create("c1", []string{top, base}); err != nil {
+		t.Fatal(err)
+	}
+	root, err := d.Mount("c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]string{
+		"etc/keep":    "base",
+		"etc/changed": "top",
+		"opaque/new":  "top",
+		"dirfile":     "now a file",
+		"link":        "base",
+		"hl2":         "linked",
+	}
+	for p, want := range expect {
+		b, err := os.ReadFile(filepath.Join(root, p))
+		if err != nil || string(b) != want {
+			t.Fatalf("%s = %q, %v; want %q", p, b, err, want)
+		}
+	}
+	for _, p := range []string{"etc/gone", "etc/.wh.gone", "opaque/old", "opaque/.wh..wh..opq"} {
+		if _, err := os.Lstat(filepath.Join(root, p)); !os.IsNotExist(err) {
+			t.Fatalf("%s should not exist: %v", p, err)
+		}
+	}
+	a, _ := os.Stat(filepath.Join(root, "hl1"))
+	b, _ := os.Stat(filepath.Join(root, "hl2"))
+	if !os.SameFile(a, b) {
+		t.Fatalf("hard link not preserved")
+	}
+	if fi, _ := os.Stat(filepath.Join(root, "etc")); !fi.ModTime().Equal(old) {
+		t.Fatalf("dir mtime = %v, want %v", fi.ModTime(), old)
+	}
+	if n, err := d.Size("c1"); err != nil || n == 0 {
+		t.Fatalf("size = %d, %v", n, err)
+	}
+	if err := d.Remove("c1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Mount("c1"); err == nil {
+		t.Fatalf("mount after remove should fail")
+	}
+}
+
+func TestOverlayStyleWhiteouts(t *testing.T) {
+	tmp := t.TempDir()
+	os.Setenv("HOME", tmp)
+	base := filepath.Join(tmp, "base")
+	top := filepath.Join(tmp, "top")
+	write(t, filepath.Join(base, "gone"), "base")
+	write(t, filepath.Join(base, "opaque", "old"), "base")
+	write(t, filepath.Join(top, "opaque", "new"), "top")
+	if err := syscall.Mknod(filepath.Join(top, "gone"), syscall.S_IFCHR, 0); err != nil {
+		t.Skipf("cannot create whiteout device: %v", err)
+	}
+	if err := syscall.Setxattr(filepath.Join(top, "opaque"), "trusted.overlay.opaque", []byte("y"), 0); err != nil {
+		t.Skipf("cannot set trusted xattr: %v", err)
+	}
+	d := Driver{}
+	if err := d.Create("c2", []string{top, base}); err != nil {
+		t.Fatal(err)
+	}
+	root, _ := d.Mount("c2")
+	for _, p := range []string{"gone", "opaque/old"} {
+		if _, err := os.Lstat(filepath.Join(root, p)); !os.IsNotExist(err) {
+			t.Fatalf("%s should be whited out: %v", p, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "opaque", "new")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getXattr(filepath.Join(root, "opaque"), "trusted.overlay.opaque"); err == nil {
+		t.Fatalf("overlay xattrs must not be copied")
+	}
+}
@@ -0,0 +1,11 @@
+// Package pty allocates pseudo-terminals for containers and switches the
+// host terminal in and out of raw mode.
+package pty
+
+// Winsize mirrors struct winsize from <sys/ioctl.h>.
+type Winsize struct {
+	Rows   uint16
+	Cols   uint16
+	Xpixel uint16
+	Ypixel uint16
+}
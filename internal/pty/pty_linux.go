@@ -0,0 +1,92 @@
+//go:build linux
+
+package pty
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Open allocates a new pseudo-terminal pair via /dev/ptmx. The caller
+// hands the slave to the container and keeps the master.
+func Open() (master, slave *os.File, err error) {
+	m, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	var unlock int32
+	if err := ioctl(m.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		m.Close()
+		return nil, nil, fmt.Errorf("unlock pty: %w", err)
+	}
+	var n uint32
+	if err := ioctl(m.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); err != nil {
+		m.Close()
+		return nil, nil, fmt.Errorf("pty number: %w", err)
+	}
+	s, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		m.Close()
+		return nil, nil, err
+	}
+	return m, s, nil
+}
+
+// IsTerminal reports whether fd refers to a terminal.
+func IsTerminal(fd uintptr) bool {
+	var t syscall.Termios
+	return ioctl(fd, syscall.TCGETS, uintptr(unsafe.Pointer(&t))) == nil
+}
+
+// GetSize returns the window size of the terminal behind fd.
+func GetSize(fd uintptr) (Winsize, error) {
+	var ws Winsize
+	err := ioctl(fd, syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws)))
+	return ws, err
+}
+
+// SetSize resizes the terminal behind fd; the foreground process group
+// gets SIGWINCH from the kernel.
+func SetSize(fd uintptr, ws Winsize) error {
+	return ioctl(fd, syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(&ws)))
+}
+
+// State is a saved terminal mode, restored with Restore.
+type State struct {
+	termios syscall.Termios
+}
+
+// MakeRaw puts the terminal behind fd into raw mode, like cfmakeraw(3),
+// and returns the previous mode.
+func MakeRaw(fd uintptr) (*State, error) {
+	var old State
+	if err := ioctl(fd, syscall.TCGETS, uintptr(unsafe.Pointer(&old.termios))); err != nil {
+		return nil, err
+	}
+	t := old.termios
+	t.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	t.Oflag &^= syscall.OPOST
+	t.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	t.Cflag &^= syscall.CSIZE | syscall.PARENB
+	t.Cflag |= syscall.CS8
+	t.Cc[syscall.VMIN] = 1
+	t.Cc[syscall.VTIME] = 0
+	if err := ioctl(fd, syscall.TCSETS, uintptr(unsafe.Pointer(&t))); err != nil {
+		return nil, err
+	}
+	return &old, nil
+}
+
+// Restore puts the terminal behind fd back into a mode saved by MakeRaw.
+func Restore(fd uintptr, st *State) error {
+	return ioctl(fd, syscall.TCSETS, uintptr(unsafe.Pointer(&st.termios)))
+}
+
+func ioctl(fd, req, arg uintptr) error {
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg); e != 0 {
+		return e
+	}
+	return nil
+}
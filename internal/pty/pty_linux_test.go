@@ -0,0 +1,85 @@
+//go:build linux
+
+package pty
+
+import (
+	"bufio"
+	"os"
+	"testing"
+)
+
+func openPair(t *testing.T) (*os.File, *os.File) {
+	t.Helper()
+	m, s, err := Open()
+	if err != nil {
+		t.Skipf("no pty support: %v", err)
+	}
+	t.Cleanup(func() {
+		m.Close()
+		s.Close()
+	})
+	return m, s
+}
+
+func TestOpenRoundTrip(t *testing.T) {
+	m, s := openPair(t)
+	if !IsTerminal(s.Fd()) || !IsTerminal(m.Fd()) {
+		t.Fatalf("pty ends should be terminals")
+	}
+	if _, err := s.Write([]byte("hello\n")); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(m).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	// OPOST|ONLCR is on by default, so the newline comes back as \r\n
+	if line != "hello\r\n" {
+		t.Fatalf("got %q", line)
+	}
+}
+
+func TestSetSize(t *testing.T) {
+	m, s := openPair(t)
+	want := Winsize{Rows: 40, Cols: 132}
+	if err := SetSize(m.Fd(), want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := GetSize(s.Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("got %+v want %+v", got, want)
+	}
+}
+
+func TestMakeRawRestore(t *testing.T) {
+	m, s := openPair(t)
+	old, err := MakeRaw(s.Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Write([]byte("x\n")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 8)
+	n, _ := m.Read(buf)
+	if string(buf[:n]) != "x\n" {
+		t.Fatalf("raw mode should not translate output, got %q", buf[:n])
+	}
+	if err := Restore(s.Fd(), old); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIsTerminalRejectsFiles(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if IsTerminal(f.Fd()) {
+		t.Fatalf("regular file reported as terminal")
+	}
+}
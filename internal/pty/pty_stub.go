@@ -0,0 +1,36 @@
+//go:build !linux
+
+package pty
+
+import (
+	"errors"
+	"os"
+)
+
+var errUnsupported = errors.New("pty: only supported on linux")
+
+func Open() (master, slave *os.File, err error) {
+	return nil, nil, errUnsupported
+}
+
+func IsTerminal(fd uintptr) bool {
+	return false
+}
+
+func GetSize(fd uintptr) (Winsize, error) {
+	return Winsize{}, errUnsupported
+}
+
+func SetSize(fd uintptr, ws Winsize) error {
+	return errUnsupported
+}
+
+type State struct{}
+
+func MakeRaw(fd uintptr) (*State, error) {
+	return nil, errUnsupported
+}
+
+func Restore(fd uintptr, st *State) error {
+	return errUnsupported
+}
@@ -0,0 +1,56 @@
+//go:build linux
+
+package state
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ProcessStartTime returns the start time of pid in clock ticks since boot,
+// as reported by field 22 of /proc/<pid>/stat.
+func ProcessStartTime(pid int) (uint64, error) {
+	fields, err := procStat(pid)
+	if err != nil {
+		return 0, err
+	}
+	// fields start at field 3 (state), so starttime is at index 19
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("short /proc/%d/stat", pid)
+	}
+	return strconv.ParseUint(fields[19], 10, 64)
+}
+
+func processAlive(pid int, startTime uint64) bool {
+	if pid <= 0 {
+		return false
+	}
+	fields, err := procStat(pid)
+	if err != nil || len(fields) < 20 {
+		return false
+	}
+	if fields[0] == "Z" || fields[0] == "X" {
+		return false
+	}
+	if startTime == 0 {
+		return true
+	}
+	return fields[19] == strconv.FormatUint(startTime, 10)
+}
+
+// procStat returns the fields of /proc/<pid>/stat that follow the command
+// name, which may itself contain spaces and parentheses.
+func procStat(pid int) ([]string, error) {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+	s := string(b)
+	i := strings.LastIndexByte(s, ')')
+	if i < 0 {
+		return nil, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	return strings.Fields(s[i+1:]), nil
+}
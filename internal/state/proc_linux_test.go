@@ -0,0 +1,66 @@
+//go:build linux
+
+package state
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"example.com/containeredu/internal/paths"
+)
+
+func TestProcessStartTimeSelf(t *testing.T) {
+	st, err := ProcessStartTime(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !processAlive(os.Getpid(), st) {
+		t.Fatalf("own process reported dead")
+	}
+	if processAlive(os.Getpid(), st+1) {
+		t.Fatalf("start time mismatch should mean a different process")
+	}
+}
+
+func TestListReconcilesStaleRecords(t *testing.T) {
+	tmp := t.TempDir()
+	os.Setenv("HOME", tmp)
+	if err := paths.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+	self, _ := ProcessStartTime(os.Getpid())
+	live := ContainerState{ID: "live", Pid: os.Getpid(), PidStartTime: self, Status: StatusRunning}
+	// a pid start time that can never match stands in for a reused pid
+	stale := ContainerState{ID: "stale", Pid: os.Getpid(), PidStartTime: self + 1, Status: StatusRunning, StartedAt: time.Now()}
+	done := ContainerState{ID: "done", Pid: 0, Status: StatusExited, ExitCode: 3}
+	for _, s := range []ContainerState{live, stale, done} {
+		if err := Save(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	items, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]ContainerState{}
+	for _, it := range items {
+		got[it.ID] = it
+	}
+	if got["live"].Status != StatusRunning {
+		t.Fatalf("live container reconciled: %+v", got["live"])
+	}
+	if got["stale"].Status != StatusDead || got["stale"].FinishedAt.IsZero() {
+		t.Fatalf("stale container not marked dead: %+v", got["stale"])
+	}
+	if got["done"].Status != StatusExited || got["done"].ExitCode != 3 {
+		t.Fatalf("exited container changed: %+v", got["done"])
+	}
+	persisted, err := Load("stale")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if persisted.Status != StatusDead {
+		t.Fatalf("reconciled status not saved: %s", persisted.Status)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package state
+
+func ProcessStartTime(pid int) (uint64, error) {
+	return 0, nil
+}
+
+// processAlive cannot inspect processes off linux, so records are trusted.
+func processAlive(pid int, startTime uint64) bool {
+	return true
+}
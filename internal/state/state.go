@@ -2,13 +2,26 @@ package state
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"example.com/containeredu/internal/paths"
 )
 
+// Container lifecycle states.
+const (
+	StatusCreated = "created"
+	StatusRunning = "running"
+	StatusPaused  = "paused"
+	StatusExited  = "exited"
+	// StatusDead marks a container whose process vanished without anyone
+	// recording an exit status, e.g. because its supervisor was killed.
+	StatusDead = "dead"
+)
+
 type ContainerState struct {
 	ID        string    `json:"id"`
 	Image     string    `json:"image"`
@@ -18,8 +31,23 @@ type ContainerState struct {
 	CreatedAt time.Time `json:"created_at"`
 	Hostname  string    `json:"hostname"`
 	IP        string    `json:"ip"`
+	Net       string    `json:"net,omitempty"`
 	Status    string    `json:"status"`
 	MountDir  string    `json:"mount_dir"`
+	// StorageDriver built MountDir; empty in records that predate
+	// storage drivers, which always used overlay.
+	StorageDriver string    `json:"storage_driver,omitempty"`
+	ExitCode      int       `json:"exit_code"`
+	StartedAt     time.Time `json:"started_at"`
+	FinishedAt    time.Time `json:"finished_at"`
+	// PidStartTime is the kernel start time of Pid (clock ticks since boot),
+	// used to tell our process apart from a later one reusing the PID.
+	PidStartTime uint64 `json:"pid_start_time,omitempty"`
+}
+
+// IsActive reports whether the record claims a live process.
+func (s ContainerState) IsActive() bool {
+	return s.Status == StatusRunning || s.Status == StatusPaused
 }
 
 func Save(s ContainerState) error {
@@ -29,7 +57,45 @@ func Save(s ContainerState) error {
 	root := paths.ContainersRoot()
 	p := filepath.Join(root, s.ID+".json")
 	b, _ := json.MarshalIndent(s, "", "  ")
-	return os.WriteFile(p, b, 0o644)
+	// the shim and the CLI both write records; each writes its own temp
+	// file and rename keeps readers from ever seeing a half-written one
+	tmp, err := os.CreateTemp(root, "."+s.ID+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(b)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), p)
+	}
+	return err
+}
+
+// Remove deletes the state record; a missing record is not an error.
+func Remove(id string) error {
+	err := os.Remove(filepath.Join(paths.ContainersRoot(), id+".json"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func Load(id string) (ContainerState, error) {
+	var s ContainerState
+	b, err := os.ReadFile(filepath.Join(paths.ContainersRoot(), id+".json"))
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return s, err
+	}
+	return s, nil
 }
 
 func List() ([]ContainerState, error) {
@@ -54,7 +120,59 @@ func List() ([]ContainerState, error) {
 		if err := json.Unmarshal(b, &s); err != nil {
 			continue
 		}
+		if reconcile(&s) {
+			_ = Save(s)
+		}
 		out = append(out, s)
 	}
 	return out, nil
 }
+
+// Find looks up a container by full ID or by a unique ID prefix, such as
+// the 8-character short IDs used for veth names.
+func Find(ref string) (ContainerState, error) {
+	if ref == "" {
+		return ContainerState{}, fmt.Errorf("empty container id")
+	}
+	items, err := List()
+	if err != nil {
+		return ContainerState{}, err
+	}
+	var matches []ContainerState
+	for _, it := range items {
+		if it.ID == ref {
+			return it, nil
+		}
+		if strings.HasPrefix(it.ID, ref) {
+			matches = append(matches, it)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return ContainerState{}, fmt.Errorf("no such container: %s", ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return ContainerState{}, fmt.Errorf("container id %s is ambiguous (%d matches)", ref, len(matches))
+	}
+}
+
+// Alive reports whether the recorded process still exists and is the same
+// process that was started for this container.
+func (s ContainerState) Alive() bool {
+	return processAlive(s.Pid, s.PidStartTime)
+}
+
+// reconcile marks active records whose process is gone as dead. It returns
+// true when the record was changed.
+func reconcile(s *ContainerState) bool {
+	if !s.IsActive() || s.Alive() {
+		return false
+	}
+	s.Status = StatusDead
+	s.ExitCode = -1
+	if s.FinishedAt.IsZero() {
+		s.FinishedAt = time.Now()
+	}
+	return true
+}
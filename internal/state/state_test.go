@@ -3,6 +3,8 @@ package state
 import (
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -136,3 +138,54 @@ func TestListNonExistentDirectory(t *testing.T) {
 		t.Fatalf("expected nil items when directory does not exist, got %+v", items)
 	}
 }
+
+func TestFindByPrefix(t *testing.T) {
+	tmp := t.TempDir()
+	os.Setenv("HOME", tmp)
+	for _, id := range []string{"abc12345-0000", "abc99999-0000", "def00000-0000"} {
+		if err := Save(ContainerState{ID: id, Status: StatusExited}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := Find("def")
+	if err != nil || s.ID != "def00000-0000" {
+		t.Fatalf("prefix lookup: %+v %v", s, err)
+	}
+	s, err = Find("abc12345-0000")
+	if err != nil || s.ID != "abc12345-0000" {
+		t.Fatalf("exact lookup: %+v %v", s, err)
+	}
+	if _, err := Find("abc"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Fatalf("expected ambiguous error, got %v", err)
+	}
+	if _, err := Find("zzz"); err == nil || !strings.Contains(err.Error(), "no such container") {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestConcurrentSaves(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = Save(ContainerState{ID: "busy-1", Pid: i, Status: StatusRunning})
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := Load("busy-1"); err != nil {
+		t.Fatal(err)
+	}
+	// no temp files left behind
+	entries, _ := os.ReadDir(paths.ContainersRoot())
+	if len(entries) != 1 {
+		t.Fatalf("containers root holds %d entries", len(entries))
+	}
+}
@@ -0,0 +1,29 @@
+//go:build linux
+
+package volumes
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"example.com/containeredu/internal/paths"
+)
+
+// lockFile takes an exclusive flock on the volumes root, held until the
+// returned file is closed.
+func lockFile() (io.Closer, error) {
+	if err := os.MkdirAll(paths.VolumesRoot(), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(paths.VolumesRoot(), ".lock"), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,46 @@
+//go:build linux
+
+package volumes
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"example.com/containeredu/internal/paths"
+)
+
+func TestLockHoldsOffOtherProcesses(t *testing.T) {
+	os.Setenv("HOME", t.TempDir())
+	if _, err := Create("data"); err != nil {
+		t.Fatal(err)
+	}
+	// a separate open file stands in for another cede process
+	f, err := os.Open(filepath.Join(paths.VolumesRoot(), ".lock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := Acquire("data", "c1")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("acquire did not wait for the lock: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if v, err := Get("data"); err != nil || len(v.Containers) != 1 {
+		t.Fatalf("volume = %+v, %v", v, err)
+	}
+}
@@ -0,0 +1,240 @@
+// Package volumes manages named volumes: directories under
+// paths.VolumesRoot() that outlive the containers mounting them. Each
+// volume records which containers use it so it cannot be removed while in
+// use.
+package volumes
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"example.com/containeredu/internal/paths"
+	"example.com/containeredu/internal/state"
+)
+
+type Volume struct {
+	Name       string    `json:"name"`
+	Mountpoint string    `json:"mountpoint"`
+	CreatedAt  time.Time `json:"created_at"`
+	// Containers lists the IDs of containers that mount the volume.
+	Containers []string `json:"containers"`
+}
+
+var (
+	mu        sync.Mutex
+	validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+)
+
+// lock serialises access to the volume records. A run acquiring a volume
+// and a volume rm may be different processes, so the in-process mutex is
+// backed by a flock on the volumes root.
+func lock() (unlock func(), err error) {
+	mu.Lock()
+	f, err := lockFile()
+	if err != nil {
+		mu.Unlock()
+		return nil, err
+	}
+	return func() {
+		f.Close()
+		mu.Unlock()
+	}, nil
+}
+
+func dir(name string) string {
+	return filepath.Join(paths.VolumesRoot(), name)
+}
+
+func metaPath(name string) string {
+	return filepath.Join(dir(name), "volume.json")
+}
+
+// ValidName reports whether name can be used for a volume.
+func ValidName(name string) bool {
+	return validName.MatchString(name)
+}
+
+// Create makes a new empty volume, or returns the existing one of that
+// name.
+func Create(name string) (Volume, error) {
+	unlock, err := lock()
+	if err != nil {
+		return Volume{}, err
+	}
+	defer unlock()
+	return create(name)
+}
+
+func create(name string) (Volume, error) {
+	if !ValidName(name) {
+		return Volume{}, fmt.Errorf("invalid volume name %q", name)
+	}
+	if v, err := load(name); err == nil {
+		return v, nil
+	}
+	v := Volume{
+		Name:       name,
+		Mountpoint: filepath.Join(dir(name), "_data"),
+		CreatedAt:  time.Now(),
+		Containers: []string{},
+	}
+	if err := os.MkdirAll(v.Mountpoint, 0o755); err != nil {
+		return Volume{}, err
+	}
+	return v, save(v)
+}
+
+func Get(name string) (Volume, error) {
+	unlock, err := lock()
+	if err != nil {
+		return Volume{}, err
+	}
+	defer unlock()
+	v, err := load(name)
+	if os.IsNotExist(err) {
+		return v, fmt.Errorf("no such volume: %s", name)
+	}
+	return v, err
+}
+
+func List() ([]Volume, error) {
+	unlock, err := lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return list()
+}
+
+func list() ([]Volume, error) {
+	entries, err := os.ReadDir(paths.VolumesRoot())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []Volume
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		v, err := load(e.Name())
+		if err != nil {
+			continue
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+// Acquire records that containerID mounts the volume, creating the volume
+// first if needed, and returns it.
+func Acquire(name, containerID string) (Volume, error) {
+	unlock, err := lock()
+	if err != nil {
+		return Volume{}, err
+	}
+	defer unlock()
+	v, err := create(name)
+	if err != nil {
+		return v, err
+	}
+	for _, c := range v.Containers {
+		if c == containerID {
+			return v, nil
+		}
+	}
+	v.Containers = append(v.Containers, containerID)
+	sort.Strings(v.Containers)
+	return v, save(v)
+}
+
+// ReleaseContainer drops containerID from every volume it was using.
+func ReleaseContainer(containerID string) error {
+	unlock, err := lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	vols, err := list()
+	if err != nil {
+		return err
+	}
+	for _, v := range vols {
+		kept := v.Containers[:0]
+		for _, c := range v.Containers {
+			if c != containerID {
+				kept = append(kept, c)
+			}
+		}
+		if len(kept) == len(v.Containers) {
+			continue
+		}
+		v.Containers = kept
+		if err := save(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove deletes a volume and its data. It fails while any container that
+// still exists is using the volume.
+func Remove(name string) error {
+	unlock, err := lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	v, err := load(name)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no such volume: %s", name)
+	}
+	if err != nil {
+		return err
+	}
+	var users []string
+	for _, c := range v.Containers {
+		// references left behind by a container that is already gone
+		// do not count
+		if _, err := state.Load(c); err == nil {
+			users = append(users, c)
+		}
+	}
+	if len(users) > 0 {
+		return fmt.Errorf("volume %s is in use by container(s) %v", name, users)
+	}
+	return os.RemoveAll(dir(name))
+}
+
+func load(name string) (Volume, error) {
+	var v Volume
+	if !ValidName(name) {
+		return v, fmt.Errorf("invalid volume name %q", name)
+	}
+	b, err := os.ReadFile(metaPath(name))
+	if err != nil {
+		return v, err
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return v, err
+	}
+	return v, nil
+}
+
+func save(v Volume) error {
+	p := metaPath(v.Name)
+	b, _ := json.MarshalIndent(v, "", "  ")
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
@@ -0,0 +1,86 @@
+package volumes
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/containeredu/internal/state"
+)
+
+func TestCreateListRemove(t *testing.T) {
+	os.Setenv("HOME", t.TempDir())
+	v, err := Create("data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(v.Mountpoint); err != nil || !fi.IsDir() {
+		t.Fatalf("mountpoint missing: %v", err)
+	}
+	again, err := Create("data")
+	if err != nil || !again.CreatedAt.Equal(v.CreatedAt) {
+		t.Fatalf("create should return the existing volume: %+v %v", again, err)
+	}
+	vols, err := List()
+	if err != nil || len(vols) != 1 || vols[0].Name != "data" {
+		t.Fatalf("list = %+v, %v", vols, err)
+	}
+	if err := Remove("data"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Get("data"); err == nil {
+		t.Fatalf("volume should be gone")
+	}
+	if err := Remove("data"); err == nil {
+		t.Fatalf("removing a missing volume should fail")
+	}
+}
+
+func TestInvalidNames(t *testing.T) {
+	os.Setenv("HOME", t.TempDir())
+	for _, n := range []string{"", "../x", "a/b", ".hidden", "-x"} {
+		if _, err := Create(n); err == nil {
+			t.Fatalf("name %q should be rejected", n)
+		}
+	}
+}
+
+func TestInUseVolumeCannotBeRemoved(t *testing.T) {
+	os.Setenv("HOME", t.TempDir())
+	if err := state.Save(state.ContainerState{ID: "c1", Status: state.StatusExited}); err != nil {
+		t.Fatal(err)
+	}
+	v, err := Acquire("shared", "c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(v.Mountpoint, "f"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Acquire("shared", "c1"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := Get("shared"); len(v.Containers) != 1 {
+		t.Fatalf("acquire should be idempotent: %v", v.Containers)
+	}
+	if err := Remove("shared"); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Fatalf("expected in-use error, got %v", err)
+	}
+	if err := ReleaseContainer("c1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Remove("shared"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStaleReferenceDoesNotBlockRemove(t *testing.T) {
+	os.Setenv("HOME", t.TempDir())
+	if _, err := Acquire("orphaned", "gone"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Remove("orphaned"); err != nil {
+		t.Fatalf("a reference from a removed container should not count: %v", err)
+	}
+}